@@ -29,13 +29,52 @@ import (
 
 // diffCmd represents the diff command
 var diffCmd = &cobra.Command{
-	Use:   "diff",
+	Use:   "diff [<commit>|<range>...] [-- <pathspec>...]",
 	Short: "Run the `git diff` command in this and all nested reposiroies",
 	Long: `Recursively checks the diff of this and each child repository under the
-current directory.`,
+current directory.
+
+By default the changes since HEAD are shown. Pass a commit or a range like
+main...HEAD to diff against that instead, and pathspecs after -- to limit the
+diff to those files.
+
+The output is shown in the same pager as git uses when writing to a terminal.
+Set diff.filter or diff.external in the ngm config to show the diffs with a
+tool like delta or difftastic.
+
+With --output the changes are written to a patch bundle instead, which
+` + "`ngm apply`" + ` applies to the repositories of the same workspace.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		log.Debugln("Running diff cmd")
-		git.Diff()
+		log.Debugf("Running diff cmd - args: %v\n", args)
+		options := git.DiffOptions{Refs: args}
+		if dash := cmd.ArgsLenAtDash(); dash != -1 {
+			options.Refs, options.Paths = args[:dash], args[dash:]
+		}
+		cached, _ := cmd.Flags().GetBool("cached")
+		staged, _ := cmd.Flags().GetBool("staged")
+		options.Cached = cached || staged
+		options.SideBySide, _ = cmd.Flags().GetBool("side-by-side")
+		noHighlight, _ := cmd.Flags().GetBool("no-highlight")
+		options.Highlight = !noHighlight
+		options.Output, _ = cmd.Flags().GetString("output")
+		noPager, _ := cmd.Flags().GetBool("no-pager")
+		options.Pager = !noPager
+		noTool, _ := cmd.Flags().GetBool("no-tool")
+		options.Tool = !noTool
+
+		stat, _ := cmd.Flags().GetBool("stat")
+		nameOnly, _ := cmd.Flags().GetBool("name-only")
+		nameStatus, _ := cmd.Flags().GetBool("name-status")
+		switch {
+		case nameStatus:
+			options.Format = git.DIFF_NAME_STATUS
+		case nameOnly:
+			options.Format = git.DIFF_NAME_ONLY
+		case stat:
+			options.Format = git.DIFF_STAT
+		}
+
+		git.Diff(options)
 		log.Debugln("Finished diff cmd")
 	},
 }
@@ -52,4 +91,15 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// diffCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	diffCmd.Flags().BoolP("side-by-side", "y", false, "Show the removed and added lines next to each other")
+	diffCmd.Flags().Bool("cached", false, "Diff the staged changes")
+	diffCmd.Flags().Bool("staged", false, "Same as --cached")
+	diffCmd.Flags().Bool("stat", false, "List the changed files with the number of changed lines")
+	diffCmd.Flags().Bool("name-only", false, "Only list the names of the changed files")
+	diffCmd.Flags().Bool("name-status", false, "Only list the names and the kind of change of the changed files")
+	diffCmd.Flags().Bool("no-highlight", false, "Don't highlight the syntax of the diff, which is slow for large diffs")
+	diffCmd.Flags().Bool("no-pager", false, "Print the output instead of showing it in the pager")
+	diffCmd.Flags().Bool("no-tool", false, "Show the diffs with the built-in renderer even if a diff tool is configured")
+	diffCmd.Flags().StringP("output", "o", "", "Write the changes of all repositories to a patch bundle")
+	diffCmd.MarkFlagsMutuallyExclusive("stat", "name-only", "name-status")
 }
@@ -36,7 +36,9 @@ var rootCmd = &cobra.Command{
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	Run: func(cmd *cobra.Command, args []string) {
-		git.Interactive()
+		watch, _ := cmd.Flags().GetBool("watch")
+		noHighlight, _ := cmd.Flags().GetBool("no-highlight")
+		git.Interactive(watch, git.DiffOptions{Highlight: !noHighlight})
 	},
 }
 
@@ -59,4 +61,6 @@ func init() {
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	// rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	rootCmd.Flags().BoolP("watch", "w", false, "Refresh repositories in the interactive view when files change")
+	rootCmd.Flags().Bool("no-highlight", false, "Don't highlight the syntax of diffs, which is slow for large diffs")
 }
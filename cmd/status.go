@@ -32,10 +32,21 @@ var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Run the `git status` command in this and all nested reposiroies",
 	Long: `Recursively checks the status of this and each child repository under the
-current directory.`,
+current directory.
+
+With --recurse-submodules, or submodules.recurse set in the ngm config, the
+submodules of each repository are included as nested repositories.
+
+With --ignored-size the repositories are instead listed by how much space their
+ignored files take, largest first, to find build artefacts bloating the
+workspace.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.Debugln("Running status cmd")
-		git.Status()
+		options := git.StatusOptions{}
+		options.Ignored, _ = cmd.Flags().GetBool("ignored")
+		options.IgnoredSize, _ = cmd.Flags().GetBool("ignored-size")
+		options.RecurseSubmodules, _ = cmd.Flags().GetBool("recurse-submodules")
+		git.Status(options)
 		log.Debugln("Finished status cmd")
 	},
 }
@@ -52,4 +63,7 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// statusCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	statusCmd.Flags().Bool("ignored", false, "Also list the ignored files")
+	statusCmd.Flags().Bool("ignored-size", false, "Only show the total size of the ignored files of each repository")
+	statusCmd.Flags().Bool("recurse-submodules", false, "Include the submodules of each repository")
 }
@@ -0,0 +1,105 @@
+package git
+
+import (
+	"strconv"
+	"strings"
+)
+
+type branchInfo struct {
+	name     string
+	remote   bool
+	current  bool
+	upstream string
+	ahead    int
+	behind   int
+	// The upstream is configured but no longer exists on the remote
+	gone bool
+}
+
+func (b branchInfo) Tracking() string {
+	if len(b.upstream) == 0 {
+		return ""
+	}
+	if b.gone {
+		return b.upstream + " [gone]"
+	}
+	return b.upstream + " ↑" + strconv.Itoa(b.ahead) + " ↓" + strconv.Itoa(b.behind)
+}
+
+func getBranches(dir string) ([]branchInfo, error) {
+	out, err := gitOutput(
+		dir, "", nil, "for-each-ref",
+		"--format=%(refname)%00%(HEAD)%00%(upstream:short)%00%(upstream:track,nobracket)%00%(symref)",
+		"refs/heads", "refs/remotes",
+	)
+	if err != nil {
+		return nil, err
+	}
+	return parseBranches(&out), nil
+}
+
+// <refname> NUL <HEAD> NUL <upstream> NUL <track> NUL <symref>
+func parseBranches(raw *string) []branchInfo {
+	branches := []branchInfo{}
+	for _, line := range strings.Split(*raw, "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) < 5 || len(fields[4]) > 0 { // skip symbolic refs like origin/HEAD
+			continue
+		}
+
+		branch := branchInfo{
+			current:  fields[1] == "*",
+			upstream: fields[2],
+		}
+		if name, ok := strings.CutPrefix(fields[0], "refs/heads/"); ok {
+			branch.name = name
+		} else {
+			branch.name, _ = strings.CutPrefix(fields[0], "refs/remotes/")
+			branch.remote = true
+		}
+
+		for _, track := range strings.Split(fields[3], ", ") {
+			kind, count, _ := strings.Cut(track, " ")
+			switch kind {
+			case "ahead":
+				branch.ahead, _ = strconv.Atoi(count)
+			case "behind":
+				branch.behind, _ = strconv.Atoi(count)
+			case "gone":
+				branch.gone = true
+			}
+		}
+
+		branches = append(branches, branch)
+	}
+	return branches
+}
+
+func runBranchCommand(dir string, args ...string) error {
+	_, err := gitOutput(dir, "", nil, args...)
+	return err
+}
+
+// Checks out the branch. Remote branches are checked out as a new local branch
+// tracking the remote one.
+func doSwitchBranch(dir string, branch branchInfo) error {
+	if branch.remote {
+		return runBranchCommand(dir, "switch", "--track", branch.name)
+	}
+	return runBranchCommand(dir, "switch", branch.name)
+}
+
+func doCreateBranch(dir string, name string) error {
+	return runBranchCommand(dir, "switch", "-c", name)
+}
+
+func doRenameBranch(dir string, from string, to string) error {
+	return runBranchCommand(dir, "branch", "-m", from, to)
+}
+
+func doDeleteBranch(dir string, name string, force bool) error {
+	if force {
+		return runBranchCommand(dir, "branch", "-D", name)
+	}
+	return runBranchCommand(dir, "branch", "-d", name)
+}
@@ -0,0 +1,36 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var branchesRaw = "refs/heads/feat/x\x00\x00origin/feat/x\x00ahead 2, behind 1\x00\n" +
+	"refs/heads/main\x00*\x00origin/main\x00\x00\n" +
+	"refs/heads/old\x00\x00origin/old\x00gone\x00\n" +
+	"refs/remotes/origin/HEAD\x00\x00\x00\x00refs/remotes/origin/main\n" +
+	"refs/remotes/origin/main\x00\x00\x00\x00\n"
+
+func TestParseBranches(t *testing.T) {
+	branches := parseBranches(&branchesRaw)
+
+	assert.Equal(t, []branchInfo{
+		{name: "feat/x", upstream: "origin/feat/x", ahead: 2, behind: 1},
+		{name: "main", current: true, upstream: "origin/main"},
+		{name: "old", upstream: "origin/old", gone: true},
+		{name: "origin/main", remote: true},
+	}, branches)
+}
+
+func TestGetBranchesReadsOnlyStdout(t *testing.T) {
+	dir := commitTestRepository(t)
+	// Makes git write its trace to stderr
+	t.Setenv("GIT_TRACE", "1")
+
+	branches, err := getBranches(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []branchInfo{{name: "main", current: true}}, branches)
+
+	assert.ErrorContains(t, doDeleteBranch(dir, "missing", false), "not found")
+}
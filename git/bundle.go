@@ -0,0 +1,245 @@
+package git
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Otard95/ngm/lib/slice"
+	"github.com/Otard95/ngm/ui"
+)
+
+const bundleHeader = "# ngm patch bundle v1"
+
+// The changes of one repository in a bundle, with the commit they're based on.
+type bundlePart struct {
+	repo  string
+	base  string
+	patch string
+}
+
+// Writes the parts after the header, each as a line naming the repository, its
+// base commit and the size of the patch, followed by the patch itself.
+func writeBundle(w io.Writer, parts []bundlePart) error {
+	if _, err := fmt.Fprintln(w, bundleHeader); err != nil {
+		return err
+	}
+	for _, part := range parts {
+		_, err := fmt.Fprintf(w, "part %q %s %d\n%s\n", part.repo, part.base, len(part.patch), part.patch)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseBundle(r io.Reader) ([]bundlePart, error) {
+	reader := bufio.NewReader(r)
+	header, err := reader.ReadString('\n')
+	if err != nil || strings.TrimSuffix(header, "\n") != bundleHeader {
+		return nil, errors.New("Not an ngm patch bundle")
+	}
+
+	parts := []bundlePart{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && len(line) == 0 {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		part, size := bundlePart{}, 0
+		if _, err := fmt.Sscanf(line, "part %q %s %d\n", &part.repo, &part.base, &size); err != nil {
+			return nil, fmt.Errorf("Invalid part %q: %w", strings.TrimSpace(line), err)
+		}
+		// The patch is followed by a newline separating it from the next part
+		patch := make([]byte, size+1)
+		if _, err := io.ReadFull(reader, patch); err != nil {
+			return nil, fmt.Errorf("The patch of %s is cut short: %w", part.repo, err)
+		}
+		part.patch = string(patch[:size])
+		parts = append(parts, part)
+	}
+}
+
+// Makes `git diff` write a patch `git apply` accepts, whatever the users git
+// config says about colors, diff tools and prefixes.
+var bundleDiffArgs = []string{"diff", "--binary", "--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/"}
+
+// The commit the patch applies to. That's HEAD unless diffing against other
+// commits, in which case it's the first commit, or the merge base of a "..."
+// range.
+func bundleBase(dir string, options DiffOptions) (string, error) {
+	orHead := func(ref string) string {
+		if len(ref) == 0 {
+			return "HEAD"
+		}
+		return ref
+	}
+
+	args := []string{"rev-parse", "--verify", "HEAD^{commit}"}
+	if len(options.Refs) > 0 {
+		ref := options.Refs[0]
+		if from, to, ok := strings.Cut(ref, "..."); ok {
+			args = []string{"merge-base", orHead(from), orHead(to)}
+		} else {
+			from, _, _ := strings.Cut(ref, "..")
+			args = []string{"rev-parse", "--verify", orHead(from) + "^{commit}"}
+		}
+	}
+	base, err := gitOutput(dir, "", nil, args...)
+	return strings.TrimSpace(base), err
+}
+
+// Reads the changes of the repository as a binary patch. When diffing the
+// working tree against HEAD, untracked files are included as added files.
+func readBundlePart(dir string, options DiffOptions) (bundlePart, error) {
+	part := bundlePart{repo: dir}
+	base, err := bundleBase(dir, options)
+	if err != nil {
+		return part, err
+	}
+	part.base = base
+
+	part.patch, err = gitOutput(dir, "", nil, slice.Concat(bundleDiffArgs, options.args())...)
+	if err != nil || options.Cached || len(options.Refs) > 0 {
+		return part, err
+	}
+
+	// Without -z, names with special characters are quoted
+	untracked, err := gitOutput(dir, "", nil, slice.Concat([]string{"ls-files", "-z", "--others", "--exclude-standard", "--"}, options.Paths)...)
+	if err != nil {
+		return part, err
+	}
+	for _, file := range slice.Filter(strings.Split(untracked, "\x00"), func(f string, _ int) bool { return len(f) > 0 }) {
+		// Exits with 1 when the files differ, which they always do
+		patch, err := gitOutput(dir, "", []int{1}, slice.Concat(bundleDiffArgs, []string{"--no-index", "--", "/dev/null", file})...)
+		if err != nil {
+			return part, err
+		}
+		part.patch += patch
+	}
+	return part, nil
+}
+
+// Writes the changes of every repository to a bundle that `ngm apply` can
+// apply to the same workspace elsewhere.
+func exportBundle(dirs []string, options DiffOptions) {
+	tasks := slice.Map(dirs, func(dir string, _ int) ui.Task[bundlePart] {
+		return ui.Task[bundlePart]{
+			Name:  dir,
+			State: ui.NotStarted,
+			Run: func() (bundlePart, error) {
+				return readBundlePart(dir, options)
+			},
+		}
+	})
+
+	results := ui.DisplayParallelProgress(tasks)
+
+	parts := []bundlePart{}
+	for i, dir := range dirs {
+		part, err := results[i].Unwrap()
+		if err != nil {
+			fmt.Printf(" %s %s\n%v\n", ui.ErrorStyle.Render("⨯"), dir, err)
+		} else if len(part.patch) == 0 {
+			fmt.Printf(" %s %s\nNo changes\n", ui.SuccessStyle.Render("✔"), dir)
+		} else {
+			fmt.Printf(" %s %s\n", ui.SuccessStyle.Render("✔"), dir)
+			parts = append(parts, part)
+		}
+	}
+
+	file, err := os.Create(options.Output)
+	if err != nil {
+		fmt.Printf("\n %s Failed to create %s: %v\n", ui.ErrorStyle.Render("⨯"), options.Output, err)
+		return
+	}
+	defer file.Close()
+	if err := writeBundle(file, parts); err != nil {
+		fmt.Printf("\n %s Failed to write %s: %v\n", ui.ErrorStyle.Render("⨯"), options.Output, err)
+		return
+	}
+	fmt.Printf("\n Wrote the changes of %d repositories to %s\n", len(parts), options.Output)
+}
+
+// Checks that the patch applies cleanly to the repository, noting if it has
+// moved on from the commit the patch is based on.
+func checkBundlePart(part bundlePart) (string, error) {
+	head, err := gitOutput(part.repo, "", nil, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	note := ""
+	if head = strings.TrimSpace(head); head != part.base {
+		note = fmt.Sprintf("Based on %.7s, but HEAD is at %.7s", part.base, head)
+	}
+	_, err = gitOutput(part.repo, part.patch, nil, "apply", "--check", "--binary", "-")
+	return note, err
+}
+
+// Applies each part of the bundle to the repository it was made from. Every
+// part is checked first, and nothing is applied unless they all apply cleanly.
+func Apply(path string, dryRun bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Printf(" %s Failed to open %s: %v\n", ui.ErrorStyle.Render("⨯"), path, err)
+		return
+	}
+	parts, err := parseBundle(file)
+	file.Close()
+	if err != nil {
+		fmt.Printf(" %s Failed to read %s: %v\n", ui.ErrorStyle.Render("⨯"), path, err)
+		return
+	}
+
+	tasks := slice.Map(parts, func(part bundlePart, _ int) ui.Task[string] {
+		return ui.Task[string]{
+			Name:  part.repo,
+			State: ui.NotStarted,
+			Run: func() (string, error) {
+				return checkBundlePart(part)
+			},
+		}
+	})
+
+	results := ui.DisplayParallelProgress(tasks)
+
+	failed := false
+	for i, part := range parts {
+		note, err := results[i].Unwrap()
+		if err != nil {
+			failed = true
+			fmt.Printf(" %s %s\n%v\n", ui.ErrorStyle.Render("⨯"), part.repo, err)
+		} else {
+			fmt.Printf(" %s %s\n", ui.SuccessStyle.Render("✔"), part.repo)
+		}
+		if len(note) > 0 {
+			fmt.Println(note)
+		}
+	}
+
+	switch {
+	case failed:
+		fmt.Println("\n Nothing was applied since some of the patches don't apply cleanly")
+		return
+	case dryRun:
+		fmt.Printf("\n All %d patches apply cleanly\n", len(parts))
+		return
+	}
+
+	applied := 0
+	for _, part := range parts {
+		if _, err := gitOutput(part.repo, part.patch, nil, "apply", "--binary", "-"); err != nil {
+			fmt.Printf(" %s Failed to apply to %s: %v\n", ui.ErrorStyle.Render("⨯"), part.repo, err)
+			continue
+		}
+		applied++
+	}
+	fmt.Printf("\n Applied the changes to %d of %d repositories\n", applied, len(parts))
+}
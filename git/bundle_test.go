@@ -0,0 +1,88 @@
+package git
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	parts := []bundlePart{
+		{repo: "./a", base: "1a2b3c4d", patch: "diff --git a/f.txt b/f.txt\n--- a/f.txt\n+++ b/f.txt\n@@ -1 +1 @@\n-a\n+b\n"},
+		{repo: "./with space", base: "5e6f7a8b", patch: "part \"./fake\" 0 0\nno trailing newline"},
+	}
+
+	buf := bytes.Buffer{}
+	assert.NoError(t, writeBundle(&buf, parts))
+	parsed, err := parseBundle(&buf)
+
+	assert.NoError(t, err)
+	assert.Equal(t, parts, parsed)
+}
+
+func TestParseBundleErrors(t *testing.T) {
+	_, err := parseBundle(bytes.NewBufferString("diff --git a/f b/f\n"))
+	assert.Error(t, err)
+
+	_, err = parseBundle(bytes.NewBufferString(bundleHeader + "\npart \"./a\" 1a2b 100\nshort"))
+	assert.Error(t, err)
+}
+
+func TestReadBundlePartWithSpecialNames(t *testing.T) {
+	dir := commitTestRepository(t)
+	os.WriteFile(filepath.Join(dir, "café.txt"), []byte("new\n"), 0644)
+
+	part, err := readBundlePart(dir, DiffOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, part.patch, "+++ b/file.txt")
+	assert.Contains(t, part.patch, `+++ "b/caf\303\251.txt"`)
+}
+
+func TestReadBundlePartIgnoresDiffConfig(t *testing.T) {
+	dir := commitTestRepository(t)
+	for _, config := range [][]string{{"color.ui", "always"}, {"diff.external", "echo external"}, {"diff.noprefix", "true"}} {
+		assert.NoError(t, exec.Command("git", "-C", dir, "config", config[0], config[1]).Run())
+	}
+
+	part, err := readBundlePart(dir, DiffOptions{})
+	assert.NoError(t, err)
+	assert.NotContains(t, part.patch, "\x1b[")
+	assert.NotContains(t, part.patch, "external")
+	assert.Contains(t, part.patch, "diff --git a/file.txt b/file.txt")
+}
+
+func TestBundleBase(t *testing.T) {
+	dir := commitTestRepository(t)
+	rev := func(ref string) string {
+		out, err := exec.Command("git", "-C", dir, "rev-parse", ref).Output()
+		assert.NoError(t, err)
+		return strings.TrimSpace(string(out))
+	}
+	first := rev("HEAD")
+	assert.NoError(t, exec.Command("git", "-C", dir, "commit", "-q", "-m", "second").Run())
+	second := rev("HEAD")
+	assert.NoError(t, exec.Command("git", "-C", dir, "checkout", "-q", "-b", "side", first).Run())
+	assert.NoError(t, exec.Command("git", "-C", dir, "commit", "-q", "--allow-empty", "-m", "side").Run())
+
+	for refs, expected := range map[string]string{
+		"":                  rev("side"),
+		"HEAD~1":            first,
+		"main..side":        second,
+		"side..":            rev("side"),
+		"main...side":       first,
+		second + "...HEAD~": first,
+	} {
+		options := DiffOptions{}
+		if len(refs) > 0 {
+			options.Refs = []string{refs}
+		}
+		base, err := bundleBase(dir, options)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, base, refs)
+	}
+}
@@ -1,11 +1,99 @@
 package git
 
-import "os/exec"
+import (
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
 
-func doCommit(dir, message string) (string, error) {
-	cmd := exec.Command("git", "-C", dir, "commit", "-m", message)
+	"github.com/Otard95/ngm/lib/slice"
+)
+
+type commitOptions struct {
+	amend    bool
+	signoff  bool
+	gpgSign  bool
+	noVerify bool
+	// Amend without changing the message
+	keepMessage bool
+	// The commit to create a `--fixup` commit for, the message is ignored when
+	// this is set
+	fixup string
+}
+
+func (options commitOptions) args() []string {
+	args := []string{}
+	if options.amend {
+		args = append(args, "--amend")
+	}
+	if options.signoff {
+		args = append(args, "--signoff")
+	}
+	if options.gpgSign {
+		args = append(args, "--gpg-sign")
+	}
+	if options.noVerify {
+		args = append(args, "--no-verify")
+	}
+	if options.keepMessage {
+		args = append(args, "--no-edit")
+	}
+	if len(options.fixup) > 0 {
+		args = append(args, "--fixup="+options.fixup)
+	}
+	return args
+}
+
+func doCommit(dir, message string, options commitOptions) (string, error) {
+	args := slice.Concat([]string{"-C", dir, "commit"}, options.args())
+	if len(options.fixup) == 0 && !options.keepMessage {
+		args = append(args, "-m", message)
+	}
+	cmd := exec.Command("git", args...)
 	out, err := cmd.CombinedOutput()
 	out_str := string(out)
 	return out_str, err
 }
 
+func getLastCommitMessage(dir string) (string, error) {
+	cmd := exec.Command("git", "-C", dir, "log", "-1", "--format=%B")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Returns the content of the file configured as `commit.template` in the
+// repository, or an empty string if there is none.
+func getCommitTemplate(dir string) string {
+	cmd := exec.Command("git", "-C", dir, "config", "--path", "--get", "commit.template")
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+
+	file := strings.TrimSpace(string(out))
+	if !path.IsAbs(file) {
+		file = path.Join(dir, file)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return string(content)
+}
+
+// Combines the commit templates of the provided repositories, only including
+// each distinct template once.
+func getCommitTemplates(dirs []*directory) string {
+	templates := []string{}
+	for _, dir := range dirs {
+		template := getCommitTemplate(dir.path)
+		if len(template) > 0 && !slices.Contains(templates, template) {
+			templates = append(templates, template)
+		}
+	}
+	return slice.Join(templates, "\n")
+}
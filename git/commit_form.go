@@ -0,0 +1,234 @@
+package git
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/Otard95/ngm/lib/slice"
+	"github.com/Otard95/ngm/ui"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	form_label_style  = lipgloss.NewStyle().Foreground(ui.ColorSubtext0).Width(10)
+	form_focus_style  = lipgloss.NewStyle().Foreground(ui.ColorMauve).Width(10)
+	form_choice_style = lipgloss.NewStyle().Foreground(ui.ColorText)
+	form_error_style  = lipgloss.NewStyle().Foreground(ui.ColorRed)
+)
+
+type commitFormField int
+
+const (
+	FORM_TYPE commitFormField = iota
+	FORM_SCOPE
+	FORM_BREAKING
+	FORM_SUBJECT
+	FORM_BODY
+	FORM_FOOTERS
+	FORM_FIELD_COUNT
+)
+
+var commitFormLabel = [FORM_FIELD_COUNT]string{"Type", "Scope", "Breaking", "Subject", "Body", "Footers"}
+
+// A form for writing conventional commits, one field per part of the message.
+type commitForm struct {
+	types     []string
+	typeIndex int
+	scope     textinput.Model
+	breaking  bool
+	subject   textinput.Model
+	body      textarea.Model
+	footers   textarea.Model
+	focus     commitFormField
+	err       error
+	// The `commit.template` the body is filled with, left out of the message
+	// unless it's edited
+	template string
+}
+
+func newCommitForm(types []string, template string) commitForm {
+	scope := textinput.New()
+	scope.Prompt = ""
+	scope.Placeholder = "optional"
+
+	subject := textinput.New()
+	subject.Prompt = ""
+	subject.Placeholder = "short description"
+
+	body := newTextarea()
+	body.Placeholder = "optional"
+	body.ShowLineNumbers = false
+	body.SetHeight(6)
+	body.SetValue(template)
+
+	footers := newTextarea()
+	footers.Placeholder = "Refs: #123"
+	footers.ShowLineNumbers = false
+	footers.SetHeight(3)
+
+	form := commitForm{
+		types:    types,
+		scope:    scope,
+		subject:  subject,
+		body:     body,
+		footers:  footers,
+		template: template,
+	}
+	form.focusField(FORM_TYPE)
+	return form
+}
+
+// Fills the form with an existing commit, e.g. when amending.
+func (form *commitForm) SetCommit(commit conventionalCommit) {
+	if i := slices.Index(form.types, strings.ToLower(commit.kind)); i != -1 {
+		form.typeIndex = i
+	}
+	form.scope.SetValue(commit.scope)
+	form.breaking = commit.breaking
+	form.subject.SetValue(commit.subject)
+	form.body.SetValue(commit.body)
+	form.footers.SetValue(slice.Join(commit.footers, "\n"))
+}
+
+func (form *commitForm) SetWidth(width int) {
+	form.scope.Width = width - form_label_style.GetWidth() - 2
+	form.subject.Width = width - form_label_style.GetWidth() - 2
+	form.body.SetWidth(width - 1)
+	form.footers.SetWidth(width - 1)
+}
+
+func (form *commitForm) focusField(field commitFormField) {
+	form.focus = (field + FORM_FIELD_COUNT) % FORM_FIELD_COUNT
+	form.scope.Blur()
+	form.subject.Blur()
+	form.body.Blur()
+	form.footers.Blur()
+
+	switch form.focus {
+	case FORM_SCOPE:
+		form.scope.Focus()
+	case FORM_SUBJECT:
+		form.subject.Focus()
+	case FORM_BODY:
+		form.body.Focus()
+	case FORM_FOOTERS:
+		form.footers.Focus()
+	}
+}
+
+func (form *commitForm) footerLines() []string {
+	return slice.Filter(
+		slice.Map(strings.Split(form.footers.Value(), "\n"), func(l string, _ int) string {
+			return strings.TrimSpace(l)
+		}),
+		func(l string, _ int) bool { return len(l) > 0 },
+	)
+}
+
+func (form *commitForm) commit() conventionalCommit {
+	body := cleanupMessage(form.body.Value())
+	if body == form.template {
+		body = ""
+	}
+	return conventionalCommit{
+		kind:     form.types[form.typeIndex],
+		scope:    strings.TrimSpace(form.scope.Value()),
+		breaking: form.breaking,
+		subject:  strings.TrimSpace(form.subject.Value()),
+		body:     body,
+		footers:  form.footerLines(),
+	}
+}
+
+// Returns the composed message, or an error if the form is incomplete.
+func (form *commitForm) Message() (string, error) {
+	commit := form.commit()
+	if len(commit.subject) == 0 {
+		return "", errors.New("the subject is required")
+	}
+	if err := validateConventionalFooters(commit.footers); err != nil {
+		return "", err
+	}
+	message := commit.String()
+	return message, validateConventionalCommit(message, form.types)
+}
+
+func (form *commitForm) SetError(err error) {
+	form.err = err
+}
+
+func (form *commitForm) Update(msg tea.Msg) tea.Cmd {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "tab":
+			form.focusField(form.focus + 1)
+			return nil
+		case "shift+tab":
+			form.focusField(form.focus - 1)
+			return nil
+		}
+
+		switch form.focus {
+		case FORM_TYPE:
+			switch msg.String() {
+			case "left", "h", "up", "k":
+				form.typeIndex = (form.typeIndex + len(form.types) - 1) % len(form.types)
+			case "right", "l", "down", "j":
+				form.typeIndex = (form.typeIndex + 1) % len(form.types)
+			}
+			return nil
+		case FORM_BREAKING:
+			switch msg.String() {
+			case " ", "space", "x", "enter":
+				form.breaking = !form.breaking
+			}
+			return nil
+		}
+	}
+
+	var cmd tea.Cmd
+	switch form.focus {
+	case FORM_SCOPE:
+		form.scope, cmd = form.scope.Update(msg)
+	case FORM_SUBJECT:
+		form.subject, cmd = form.subject.Update(msg)
+	case FORM_BODY:
+		form.body, cmd = form.body.Update(msg)
+	case FORM_FOOTERS:
+		form.footers, cmd = form.footers.Update(msg)
+	}
+	return cmd
+}
+
+func (form *commitForm) label(field commitFormField) string {
+	if form.focus == field {
+		return form_focus_style.Render(commitFormLabel[field])
+	}
+	return form_label_style.Render(commitFormLabel[field])
+}
+
+func (form commitForm) View() string {
+	breaking := "[ ]"
+	if form.breaking {
+		breaking = "[x]"
+	}
+
+	lines := []string{
+		" " + form.label(FORM_TYPE) + form_choice_style.Render("< "+form.types[form.typeIndex]+" >"),
+		" " + form.label(FORM_SCOPE) + form.scope.View(),
+		" " + form.label(FORM_BREAKING) + form_choice_style.Render(breaking),
+		" " + form.label(FORM_SUBJECT) + form.subject.View(),
+		" " + form.label(FORM_BODY),
+		form.body.View(),
+		" " + form.label(FORM_FOOTERS),
+		form.footers.View(),
+	}
+	if form.err != nil {
+		lines = append(lines, form_error_style.Render(" "+form.err.Error()))
+	}
+	return slice.Join(lines, "\n")
+}
@@ -0,0 +1,89 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Where ngm keeps the files of the workspace, in its root.
+const workspaceDir = ".ngm"
+
+// The absolute path of the file in the workspace directory, so it points to the
+// same file from commands running in other directories.
+func workspaceFile(name string) string {
+	file := filepath.Join(workspaceDir, name)
+	if abs, err := filepath.Abs(file); err == nil {
+		return abs
+	}
+	return file
+}
+
+// The config files are in the git config format and read with `git config`,
+// the workspace config taking precedence over the users global config.
+func configFiles() []string {
+	files := []string{workspaceFile("config")}
+	if home, err := os.UserConfigDir(); err == nil {
+		files = append(files, path.Join(home, "ngm", "config"))
+	}
+	return files
+}
+
+func getConfig(key string) (string, bool) {
+	for _, file := range configFiles() {
+		cmd := exec.Command("git", "config", "-f", file, "--get", key)
+		out, err := cmd.Output()
+		if err == nil {
+			return strings.TrimSpace(string(out)), true
+		}
+	}
+	return "", false
+}
+
+func getConfigBool(key string) bool {
+	for _, file := range configFiles() {
+		cmd := exec.Command("git", "config", "-f", file, "--type=bool", "--get", key)
+		out, err := cmd.Output()
+		if err == nil {
+			return strings.TrimSpace(string(out)) == "true"
+		}
+	}
+	return false
+}
+
+func getConfigList(key string, defaultValue []string) []string {
+	value, ok := getConfig(key)
+	if !ok {
+		return defaultValue
+	}
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Reads every key of the section, with the workspace config taking precedence.
+// The keys are lower case, without the section name.
+func getConfigSection(section string) map[string]string {
+	values := map[string]string{}
+	files := configFiles()
+	for i := len(files) - 1; i >= 0; i-- {
+		cmd := exec.Command("git", "config", "-f", files[i], "--get-regexp", "^"+section+`\.`)
+		out, err := cmd.Output()
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			name, value, _ := strings.Cut(line, " ")
+			if name, ok := strings.CutPrefix(name, section+"."); ok {
+				values[name] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,100 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+type conflictSide int
+
+const (
+	OURS conflictSide = iota
+	THEIRS
+	CONFLICT_SIDE_COUNT
+)
+
+var conflictSideName = [CONFLICT_SIDE_COUNT]string{"ours", "theirs"}
+
+func (side conflictSide) String() string {
+	return conflictSideName[side]
+}
+
+// Whether the side has a version of the file, which it doesn't when it deleted
+// the file or the other side added it.
+func (c unmergedChange) Has(side conflictSide) bool {
+	if side == OURS {
+		return c.kind[0] != DELETED && !(c.kind[0] == UNMERGED && c.kind[1] == ADDED)
+	}
+	return c.kind[1] != DELETED && !(c.kind[0] == ADDED && c.kind[1] == UNMERGED)
+}
+
+// A region of a file between conflict markers.
+type conflict struct {
+	oursLabel   string
+	theirsLabel string
+	ours        []string
+	// Only set with the `diff3` and `zdiff3` conflict styles
+	base   []string
+	theirs []string
+}
+
+func parseConflicts(content string) []conflict {
+	conflicts := []conflict{}
+	var current *conflict
+	section := &[]string{}
+
+	for _, line := range strings.Split(content, "\n") {
+		switch {
+		case strings.HasPrefix(line, "<<<<<<<"):
+			current = &conflict{oursLabel: strings.TrimSpace(line[7:])}
+			section = &current.ours
+		case current == nil:
+			continue
+		case strings.HasPrefix(line, "|||||||"):
+			section = &current.base
+		case strings.HasPrefix(line, "======="):
+			section = &current.theirs
+		case strings.HasPrefix(line, ">>>>>>>"):
+			current.theirsLabel = strings.TrimSpace(line[7:])
+			conflicts = append(conflicts, *current)
+			current = nil
+		default:
+			*section = append(*section, line)
+		}
+	}
+	return conflicts
+}
+
+func getConflicts(dir string, file string) ([]conflict, error) {
+	content, err := os.ReadFile(path.Join(dir, file))
+	if err != nil {
+		return nil, err
+	}
+	return parseConflicts(string(content)), nil
+}
+
+func runConflictCommand(dir string, args ...string) error {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	out, err := cmd.CombinedOutput()
+	return commandError(out, err)
+}
+
+// Resolves the conflict by taking the side's version of the file and staging
+// it. If the side doesn't have the file, it's removed.
+func doResolveConflict(dir string, c unmergedChange, side conflictSide) error {
+	if !c.Has(side) {
+		return runConflictCommand(dir, "rm", "--", c.file)
+	}
+	if err := runConflictCommand(dir, "checkout", "--"+side.String(), "--", c.file); err != nil {
+		return err
+	}
+	return runConflictCommand(dir, "add", "--", c.file)
+}
+
+// Runs `git mergetool` for the file, which uses the tool configured with
+// `merge.tool`.
+func mergetoolCommand(dir string, file string) *exec.Cmd {
+	return exec.Command("git", "-C", dir, "mergetool", "--no-prompt", "--", file)
+}
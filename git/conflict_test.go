@@ -0,0 +1,58 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var conflictContent = `package main
+
+<<<<<<< HEAD
+func ours() {}
+=======
+func theirs() {}
+func more() {}
+>>>>>>> feature
+between
+<<<<<<< HEAD
+a
+||||||| base
+b
+=======
+c
+>>>>>>> feature
+`
+
+func TestParseConflicts(t *testing.T) {
+	conflicts := parseConflicts(conflictContent)
+
+	assert.Equal(t, []conflict{
+		{
+			oursLabel:   "HEAD",
+			theirsLabel: "feature",
+			ours:        []string{"func ours() {}"},
+			theirs:      []string{"func theirs() {}", "func more() {}"},
+		},
+		{
+			oursLabel:   "HEAD",
+			theirsLabel: "feature",
+			ours:        []string{"a"},
+			base:        []string{"b"},
+			theirs:      []string{"c"},
+		},
+	}, conflicts)
+}
+
+func TestUnmergedChangeHas(t *testing.T) {
+	deletedByUs := unmergedChange{kind: [2]changeKind{DELETED, UNMERGED}}
+	addedByUs := unmergedChange{kind: [2]changeKind{ADDED, UNMERGED}}
+	bothModified := unmergedChange{kind: [2]changeKind{UNMERGED, UNMERGED}}
+
+	assert.False(t, deletedByUs.Has(OURS))
+	assert.True(t, deletedByUs.Has(THEIRS))
+	assert.True(t, addedByUs.Has(OURS))
+	assert.False(t, addedByUs.Has(THEIRS))
+	assert.True(t, bothModified.Has(OURS))
+	assert.True(t, bothModified.Has(THEIRS))
+}
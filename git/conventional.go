@@ -0,0 +1,106 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Otard95/ngm/lib/slice"
+)
+
+// https://www.conventionalcommits.org/en/v1.0.0/
+var (
+	defaultConventionalTypes = []string{
+		"feat", "fix", "docs", "style", "refactor", "perf", "test", "build", "ci", "chore", "revert",
+	}
+	conventionalHeader = regexp.MustCompile(`^(\w+)(\(([^()\r\n]+)\))?(!)?: (\S.*)$`)
+	conventionalFooter = regexp.MustCompile(`^([\w-]+|BREAKING[ -]CHANGE)(: | #)\S`)
+)
+
+type conventionalCommit struct {
+	kind     string
+	scope    string
+	breaking bool
+	subject  string
+	body     string
+	footers  []string
+}
+
+func (c conventionalCommit) String() string {
+	out := c.kind
+	if len(c.scope) > 0 {
+		out += "(" + c.scope + ")"
+	}
+	if c.breaking {
+		out += "!"
+	}
+	out += ": " + c.subject
+
+	if body := strings.TrimSpace(c.body); len(body) > 0 {
+		out += "\n\n" + body
+	}
+	if len(c.footers) > 0 {
+		out += "\n\n" + slice.Join(c.footers, "\n")
+	}
+	return out
+}
+
+// Splits a commit message into its conventional parts. Messages not following
+// the specification end up entirely in the subject and body.
+func parseConventionalCommit(message string) conventionalCommit {
+	header, rest, _ := strings.Cut(strings.TrimSpace(message), "\n")
+
+	var commit conventionalCommit
+	if match := conventionalHeader.FindStringSubmatch(header); match != nil {
+		commit.kind = match[1]
+		commit.scope = match[3]
+		commit.breaking = len(match[4]) > 0
+		commit.subject = match[5]
+	} else {
+		commit.subject = header
+	}
+
+	paragraphs := strings.Split(strings.TrimSpace(rest), "\n\n")
+	last := strings.Split(paragraphs[len(paragraphs)-1], "\n")
+	if len(paragraphs[len(paragraphs)-1]) > 0 && validateConventionalFooters(last) == nil {
+		commit.footers = last
+		paragraphs = paragraphs[:len(paragraphs)-1]
+	}
+	commit.body = slice.Join(paragraphs, "\n\n")
+
+	return commit
+}
+
+func conventionalTypes() []string {
+	return getConfigList("commit.conventionalTypes", defaultConventionalTypes)
+}
+
+// Validates the message against the conventional commits specification,
+// allowing only the provided types.
+func validateConventionalCommit(message string, types []string) error {
+	lines := strings.Split(message, "\n")
+
+	match := conventionalHeader.FindStringSubmatch(lines[0])
+	if match == nil {
+		return errors.New("the first line must be on the form `type(scope)!: subject`")
+	}
+	if !slices.Contains(types, strings.ToLower(match[1])) {
+		return fmt.Errorf("unknown type '%s', expected one of: %s", match[1], slice.Join(types, ", "))
+	}
+	if len(lines) > 1 && len(strings.TrimSpace(lines[1])) > 0 {
+		return errors.New("the subject must be followed by a blank line")
+	}
+
+	return nil
+}
+
+func validateConventionalFooters(footers []string) error {
+	for _, footer := range footers {
+		if !conventionalFooter.MatchString(footer) {
+			return fmt.Errorf("invalid footer '%s', expected `Token: value` or `Token #value`", footer)
+		}
+	}
+	return nil
+}
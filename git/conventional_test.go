@@ -0,0 +1,50 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateConventionalCommit(t *testing.T) {
+	types := []string{"feat", "fix"}
+
+	assert.NoError(t, validateConventionalCommit("feat: add thing", types))
+	assert.NoError(t, validateConventionalCommit("fix(parser)!: handle quotes\n\nBody", types))
+	assert.Error(t, validateConventionalCommit("add thing", types))
+	assert.Error(t, validateConventionalCommit("docs: add thing", types))
+	assert.Error(t, validateConventionalCommit("feat: add thing\nno blank line", types))
+	assert.Error(t, validateConventionalCommit("feat:", types))
+}
+
+func TestConventionalCommitString(t *testing.T) {
+	commit := conventionalCommit{
+		kind:     "feat",
+		scope:    "ui",
+		breaking: true,
+		subject:  "add form",
+		body:     "Some body",
+		footers:  []string{"Refs: #12"},
+	}
+
+	assert.Equal(t, "feat(ui)!: add form\n\nSome body\n\nRefs: #12", commit.String())
+	assert.NoError(t, validateConventionalFooters(commit.footers))
+	assert.Error(t, validateConventionalFooters([]string{"not a footer"}))
+}
+
+func TestParseConventionalCommit(t *testing.T) {
+	commit := parseConventionalCommit("feat(ui)!: add form\n\nSome body\n\nMore body\n\nRefs: #12\nBREAKING CHANGE: removed flag")
+
+	assert.Equal(t, "feat", commit.kind)
+	assert.Equal(t, "ui", commit.scope)
+	assert.True(t, commit.breaking)
+	assert.Equal(t, "add form", commit.subject)
+	assert.Equal(t, "Some body\n\nMore body", commit.body)
+	assert.Equal(t, []string{"Refs: #12", "BREAKING CHANGE: removed flag"}, commit.footers)
+
+	plain := parseConventionalCommit("Fix things")
+	assert.Equal(t, "", plain.kind)
+	assert.Equal(t, "Fix things", plain.subject)
+	assert.Equal(t, "", plain.body)
+	assert.Nil(t, plain.footers)
+}
@@ -2,12 +2,14 @@ package git
 
 import (
 	"fmt"
-	"os/exec"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/Otard95/ngm/lib/slice"
 	"github.com/Otard95/ngm/ui"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/term"
 )
 
 var (
@@ -17,162 +19,558 @@ var (
 	diffHeader    = lipgloss.NewStyle().Foreground(ui.ColorText)
 )
 
+// The width of side by side diffs when the width of the terminal is unknown.
+const defaultDiffWidth = 120
+
+// What `ngm diff` lists for each repository.
+type DiffFormat int
+
+const (
+	DIFF_PATCH DiffFormat = iota
+	DIFF_STAT
+	DIFF_NAME_ONLY
+	DIFF_NAME_STATUS
+	DIFF_FORMAT_COUNT
+)
+
+var diffFormatFlag = [DIFF_FORMAT_COUNT]string{"", "--numstat", "--name-only", "--name-status"}
+
+// What to diff, and how the diffs are shown by `ngm diff` and the interactive
+// view.
+type DiffOptions struct {
+	// Diff the staged changes instead of all changes
+	Cached bool
+	// The commit, commits or range to diff against, HEAD if none
+	Refs []string
+	// Only diff the files matching these pathspecs
+	Paths  []string
+	Format DiffFormat
+	// Show the removed and added lines next to each other
+	SideBySide bool
+	// Color the syntax of the changed files
+	Highlight bool
+	// Write the changes to this patch bundle instead of showing them
+	Output string
+	// Show the diffs with the diff tool configured in the ngm config
+	Tool bool
+	// Show the output in the pager when writing to a terminal
+	Pager bool
+}
+
+// The arguments to `git diff` selecting what to diff.
+func (options DiffOptions) args() []string {
+	args := []string{}
+	if options.Cached {
+		args = append(args, "--cached")
+	}
+	if len(options.Refs) > 0 {
+		args = append(args, options.Refs...)
+	} else if !options.Cached {
+		args = append(args, "HEAD")
+	}
+	if len(options.Paths) > 0 {
+		args = append(append(args, "--"), options.Paths...)
+	}
+	return args
+}
+
+// What kind of change a diff is, which decides how it's shown.
+type diffKind int
+
+const (
+	DIFF_KIND_TEXT diffKind = iota
+	DIFF_KIND_BINARY
+	// Only the file mode changed
+	DIFF_KIND_MODE
+	// Renamed or copied without changes to the content
+	DIFF_KIND_RENAME
+	DIFF_KIND_SUBMODULE
+	DIFF_KIND_COUNT
+)
+
+// The mode git gives submodules.
+const submoduleMode = "160000"
+
 type diff struct {
-	src     string
-	dst     string
+	src  string
+	dst  string
+	kind diffKind
+	// The modes of the file before and after, the same if it didn't change
+	oldMode string
+	newMode string
+	// How similar a renamed or copied file is to the original, in percent
+	similarity int
+	// Every line before the hunks, including the `---` and `+++` lines
 	headers []string
-	hunk    []string
+	hunks   []hunk
 }
 
 func (diff diff) Title() string {
 	a, _ := strings.CutPrefix(diff.src, "a/")
 	b, _ := strings.CutPrefix(diff.dst, "b/")
-	if diff.src == "/dev/null" {
-		return b + " [added]"
+	title := a
+	switch {
+	case diff.src == "/dev/null":
+		title = b + " [added]"
+	case diff.dst == "/dev/null":
+		title = a + " [deleted]"
+	case a != b && diff.similarity > 0:
+		title = fmt.Sprintf("%s -> %s (%d%%)", a, b, diff.similarity)
+	case a != b:
+		title = a + " -> " + b
 	}
-	if diff.dst == "/dev/null" {
-		return a + " [deleted]"
+
+	switch diff.kind {
+	case DIFF_KIND_BINARY:
+		title += " [binary]"
+	case DIFF_KIND_SUBMODULE:
+		title += " [submodule]"
+	}
+	return title
+}
+
+// Describes changes without a hunk to show, or an empty string for changes to
+// the content of text files.
+func (diff diff) Summary() string {
+	switch diff.kind {
+	case DIFF_KIND_BINARY:
+		return "Binary file changed"
+	case DIFF_KIND_MODE:
+		return fmt.Sprintf("Mode changed from %s to %s", diff.oldMode, diff.newMode)
+	case DIFF_KIND_RENAME:
+		text := "Renamed without changes"
+		if diff.oldMode != diff.newMode {
+			text += fmt.Sprintf(", mode changed from %s to %s", diff.oldMode, diff.newMode)
+		}
+		return text
+	case DIFF_KIND_SUBMODULE:
+		old, new, dirty := diff.submoduleCommits()
+		switch {
+		case len(old) == 0:
+			return "Submodule added at " + new
+		case len(new) == 0:
+			return "Submodule removed from " + old
+		case old == new && dirty:
+			return "Submodule has uncommitted changes at " + new
+		case dirty:
+			return "Submodule moved from " + old + " to " + new + " and has uncommitted changes"
+		}
+		return "Submodule moved from " + old + " to " + new
+	case DIFF_KIND_TEXT:
+		// Only added or deleted empty files have no hunk
+		if len(diff.hunks) == 0 {
+			return "Empty file"
+		}
+	}
+	return ""
+}
+
+// The short commits the submodule moved between, read from the hunk, or the
+// index line when there is no hunk, and whether the submodule has changes that
+// aren't committed.
+func (diff diff) submoduleCommits() (string, string, bool) {
+	short := func(commit string) string {
+		if strings.Trim(commit, "0") == "" {
+			return ""
+		}
+		return commit[:min(len(commit), 7)]
+	}
+
+	old, new := "", ""
+	for _, h := range diff.hunks {
+		for _, l := range h.lines {
+			commit, ok := strings.CutPrefix(l.text, "Subproject commit ")
+			switch {
+			case ok && l.kind == HUNK_REMOVED:
+				old = commit
+			case ok && l.kind == HUNK_ADDED:
+				new = commit
+			}
+		}
+	}
+	if len(old) == 0 && len(new) == 0 {
+		for _, l := range diff.headers {
+			if index, ok := strings.CutPrefix(l, "index "); ok {
+				hashes, _, _ := strings.Cut(index, " ")
+				old, new, _ = strings.Cut(hashes, "..")
+			}
+		}
 	}
-	if diff.dst != diff.src {
-		return a + " -> " + b
-	} else {
+	new, dirty := strings.CutSuffix(new, "-dirty")
+	return short(old), short(new), dirty
+}
+
+// The path of the file after the change, or before it if it was deleted.
+func (diff diff) File() string {
+	if diff.dst == "/dev/null" {
+		a, _ := strings.CutPrefix(diff.src, "a/")
 		return a
 	}
+	b, _ := strings.CutPrefix(diff.dst, "b/")
+	return b
 }
+
 func (diff diff) String() string {
-	title := diff.Title()
+	return diff.Render(DiffOptions{})
+}
 
+func (diff diff) titleBox() string {
+	title := diff.Title()
 	return "┏" + strings.Repeat("━", len(title)+2) + "┓\n" +
 		"┃ " + title + " ┃\n" +
-		"┗" + strings.Repeat("━", len(title)+2) + "┛\n" +
-		slice.Join(
-			slice.Map(
-				diff.hunk,
-				func(l string, _ int) string {
-					if strings.HasPrefix(l, "-") {
-						return diffRemove.Render(l)
-					}
-					if strings.HasPrefix(l, "+") {
-						return diffAdd.Render(l)
-					}
-					return l
-				},
-			),
-			"\n",
-		)
+		"┗" + strings.Repeat("━", len(title)+2) + "┛"
+}
+
+// Renders the title and hunks of the diff, with the line numbers in a gutter.
+func (diff diff) Render(options DiffOptions) string {
+	if summary := diff.Summary(); len(summary) > 0 {
+		return diff.titleBox() + "\n" + diffUnchanged.Render(summary)
+	}
 
+	lines := []string{diff.titleBox()}
+	gutter := gutterWidth(diff.hunks)
+	for _, h := range diff.hunks {
+		lines = append(lines, h.render(diff.File(), gutter, options.Highlight)...)
+	}
+	return slice.Join(lines, "\n")
 }
+
 func (diff diff) Patch() string {
-	return slice.Join(
-		slice.Concat(
-			diff.headers,
-			[]string{
-				"--- " + diff.src,
-				"+++ " + diff.dst,
-			},
-			diff.hunk,
-		),
-		"\n",
-	)
+	lines := diff.headers
+	for _, h := range diff.hunks {
+		lines = slice.Concat(lines, h.rawLines())
+	}
+	return slice.Join(lines, "\n")
+}
+
+// What `ngm diff` found in a repository, depending on the format.
+type diffResult struct {
+	difs  []diff
+	stats []fileStat
+	names []string
+	// What the diff tool printed, shown in place of the diffs
+	output string
 }
 
-func Diff() {
+// The tool configured to show diffs in place of the built-in rendering. A
+// filter gets the patch of each repository on stdin, like delta, while an
+// external diff is run by git for each file, like difftastic.
+type diffTool struct {
+	filter   string
+	external string
+}
+
+func (tool diffTool) enabled() bool {
+	return len(tool.filter) > 0 || len(tool.external) > 0
+}
+
+func Diff(options DiffOptions) {
+	width, _, err := term.GetSize(os.Stdout.Fd())
+	if err != nil || width <= 0 {
+		width = defaultDiffWidth
+	}
+
 	dirs := getDirectories(false)
+	if len(options.Output) > 0 {
+		exportBundle(dirs, options)
+		return
+	}
 
-	tasks := slice.Map(dirs, func(dir string, _ int) ui.Task[[]diff] {
-		return ui.Task[[]diff]{
+	tool := diffTool{}
+	if options.Tool && options.Format == DIFF_PATCH && !options.SideBySide {
+		tool.filter, _ = getConfig("diff.filter")
+		tool.external, _ = getConfig("diff.external")
+	}
+
+	tasks := slice.Map(dirs, func(dir string, _ int) ui.Task[diffResult] {
+		return ui.Task[diffResult]{
 			Name:  dir,
 			State: ui.NotStarted,
-			Run: func() ([]diff, error) {
-				return getDiff(dir)
+			Run: func() (diffResult, error) {
+				return readDiff(dir, options, tool, width)
 			},
 		}
 	})
 
 	results := ui.DisplayParallelProgress(tasks)
 
+	out := strings.Builder{}
+	total, changed := diffSummary{}, 0
 	for i, dir := range dirs {
-		out, err := results[i].Unwrap()
+		result, err := results[i].Unwrap()
 		if err != nil {
-			fmt.Printf(" %s %s\n%v\n", ui.ErrorStyle.Render("⨯"), dir, err)
-		} else {
-			fmt.Printf(" %s %s\n%s\n", ui.SuccessStyle.Render("✔"), dir, slice.Join(
+			fmt.Fprintf(&out, " %s %s\n%v\n", ui.ErrorStyle.Render("⨯"), dir, err)
+			continue
+		}
+
+		fmt.Fprintf(&out, " %s %s\n", ui.SuccessStyle.Render("✔"), dir)
+		switch options.Format {
+		case DIFF_PATCH:
+			if tool.enabled() {
+				fmt.Fprintln(&out, strings.TrimRight(result.output, "\n"))
+				break
+			}
+			fmt.Fprintln(&out, slice.Join(
 				slice.Map(
-					out,
+					result.difs,
 					func(d diff, _ int) string {
-						return d.String()
+						if options.SideBySide {
+							return d.SideBySide(width, options.Highlight)
+						}
+						return d.Render(options)
 					},
 				),
 				"\n\n",
 			))
+		case DIFF_STAT:
+			if len(result.stats) > 0 {
+				fmt.Fprintln(&out, renderStats(result.stats))
+			}
+		case DIFF_NAME_ONLY:
+			if len(result.names) > 0 {
+				fmt.Fprintln(&out, slice.Join(result.names, "\n"))
+			}
+		case DIFF_NAME_STATUS:
+			if len(result.names) > 0 {
+				fmt.Fprintln(&out, slice.Join(slice.Map(result.names, func(l string, _ int) string {
+					return renderNameStatus(l)
+				}), "\n"))
+			}
+		}
+
+		if len(result.stats) > 0 {
+			summary := summarize(result.stats)
+			fmt.Fprintln(&out, " "+summary.String())
+			total = total.add(summary)
+			changed++
+		}
+	}
+
+	if options.Format == DIFF_PATCH || options.Format == DIFF_STAT {
+		fmt.Fprintf(&out, "\n Total: %s in %d of %d repositories\n", total, changed, len(dirs))
+	}
+
+	page(out.String(), options.Pager)
+}
+
+func runDiff(dir string, options DiffOptions, flags ...string) (string, error) {
+	out, err := gitOutput(dir, "", nil, slice.Concat([]string{"diff"}, flags, options.args())...)
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// Reads what's needed for the format. Patches and stats are summarized, so the
+// stats are read for them too.
+func readDiff(dir string, options DiffOptions, tool diffTool, width int) (diffResult, error) {
+	result := diffResult{}
+	if options.Format == DIFF_NAME_ONLY || options.Format == DIFF_NAME_STATUS {
+		out, err := runDiff(dir, options, diffFormatFlag[options.Format])
+		result.names = slice.Filter(strings.Split(out, "\n"), func(l string, _ int) bool { return len(l) > 0 })
+		return result, err
+	}
+
+	if options.Format == DIFF_PATCH {
+		var err error
+		switch {
+		case len(tool.external) > 0:
+			result.output, err = externalDiff(dir, tool.external, options, width)
+		case len(tool.filter) > 0:
+			patch := ""
+			if patch, err = runDiff(dir, options); err == nil && len(patch) > 0 {
+				result.output, err = filterDiff(tool.filter, patch, width)
+			}
+		default:
+			result.difs, err = getDiff(dir, options)
+		}
+		if err != nil {
+			return result, err
 		}
 	}
+	out, err := runDiff(dir, options, diffFormatFlag[DIFF_STAT])
+	result.stats = parseNumstat(out)
+	return result, err
 }
 
-func getDiff(dir string) ([]diff, error) {
-	cmd := exec.Command("git", "-C", dir, "diff", "HEAD")
-	out, err := cmd.CombinedOutput()
-	out_str := string(out)
+func getDiff(dir string, options DiffOptions) ([]diff, error) {
+	out, err := runDiff(dir, options)
 	if err != nil {
 		return nil, err
 	}
-	return parseGitDiff(&out_str), nil
+	return parseGitDiff(&out), nil
+}
+
+// Colors a line of `git diff --name-status` by the kind of change.
+func renderNameStatus(l string) string {
+	status, files, _ := strings.Cut(l, "\t")
+	files = strings.ReplaceAll(files, "\t", " -> ")
+	switch status[0] {
+	case 'A':
+		return diffAdd.Render(status + "\t" + files)
+	case 'D':
+		return diffRemove.Render(status + "\t" + files)
+	}
+	return diffHeader.Render(status + "\t" + files)
+}
+
+// Cuts the C-style quoted path git writes for paths with special characters
+// from the start of the text, returning the unquoted path and the rest of the
+// text after the space following it. Returns false if the text doesn't start
+// with a quoted path.
+func cutQuotedPath(text string) (string, string, bool) {
+	if !strings.HasPrefix(text, `"`) {
+		return "", text, false
+	}
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			path, err := strconv.Unquote(text[:i+1])
+			if err != nil {
+				return "", text, false
+			}
+			return path, strings.TrimPrefix(text[i+1:], " "), true
+		}
+	}
+	return "", text, false
+}
+
+// Unquotes the path if git quoted it.
+func unquotePath(path string) string {
+	if unquoted, rest, ok := cutQuotedPath(path); ok && len(rest) == 0 {
+		return unquoted
+	}
+	return path
+}
+
+// Reads the paths from a line like "diff --git a/file b/file". The paths are
+// ambiguous when they contain " b/", so when the file isn't renamed both halves
+// of the line are expected to be the same path.
+func parseDiffPaths(line string) (string, string) {
+	paths, ok := strings.CutPrefix(line, "diff --git ")
+	if !ok {
+		// Combined diffs of unmerged files only name the one file
+		_, file, _ := strings.Cut(strings.TrimPrefix(line, "diff --"), " ")
+		file = unquotePath(file)
+		return "a/" + file, "b/" + file
+	}
+	// Either path may be quoted, while the other isn't
+	if src, rest, ok := cutQuotedPath(paths); ok {
+		return src, unquotePath(rest)
+	}
+	if i := strings.LastIndex(paths, ` "b/`); i != -1 {
+		if dst, rest, ok := cutQuotedPath(paths[i+1:]); ok && len(rest) == 0 {
+			return paths[:i], dst
+		}
+	}
+	if n := len(paths); n%2 == 1 && strings.HasPrefix(paths, "a/") && paths[n/2+1:n/2+3] == "b/" &&
+		paths[2:n/2] == paths[n/2+3:] {
+		return paths[:n/2], paths[n/2+1:]
+	}
+	if i := strings.LastIndex(paths, " b/"); i != -1 {
+		return paths[:i], paths[i+1:]
+	}
+	return paths, paths
 }
 
 func parseGitDiff(raw_diff *string) []diff {
 	diffs := []diff{}
-	headers := []string{}
-	src, dst := "", ""
-	hunkLines := []string{}
-
-	lines := strings.Split(*raw_diff, "\n")
-
-	for _, line := range lines {
-		if strings.HasPrefix(line, "diff") {
-			if len(src) > 0 {
-				diffs = append(diffs, diff{
-					src:     src,
-					dst:     dst,
-					headers: headers,
-					hunk:    hunkLines,
-				})
-				headers = []string{}
-				src, dst = "", ""
-				hunkLines = []string{}
-			}
-			headers = append(headers, line)
-			continue
+	var current *diff
+	binary := false
+	// The lines of the hunk being read, starting with its header
+	hunk_lines := []string{}
+
+	finishHunk := func() {
+		if h, ok := parseHunk(hunk_lines); ok {
+			current.hunks = append(current.hunks, h)
+		}
+		hunk_lines = []string{}
+	}
+
+	finish := func() {
+		if current == nil {
+			return
 		}
+		finishHunk()
+		isRename := current.similarity > 0 && current.src != current.dst
+		isSubmodule := current.oldMode == submoduleMode || current.newMode == submoduleMode ||
+			slice.Some(current.hunks, func(h hunk) bool {
+				return slice.Some(h.lines, func(l hunkLine) bool { return strings.HasPrefix(l.text, "Subproject commit ") })
+			})
+		switch {
+		case isSubmodule:
+			current.kind = DIFF_KIND_SUBMODULE
+		case binary:
+			current.kind = DIFF_KIND_BINARY
+		case len(current.hunks) > 0:
+			current.kind = DIFF_KIND_TEXT
+		case isRename:
+			current.kind = DIFF_KIND_RENAME
+		case current.oldMode != current.newMode && current.src != "/dev/null" && current.dst != "/dev/null":
+			current.kind = DIFF_KIND_MODE
+		}
+		diffs = append(diffs, *current)
+		current, binary = nil, false
+	}
 
-		if strings.HasPrefix(line, "---") {
-			src, _ = strings.CutPrefix(line, "--- ")
+	for _, line := range strings.Split(*raw_diff, "\n") {
+		if strings.HasPrefix(line, "diff --") {
+			finish()
+			src, dst := parseDiffPaths(line)
+			current = &diff{src: src, dst: dst, headers: []string{line}}
 			continue
 		}
-		if strings.HasPrefix(line, "+++") {
-			dst, _ = strings.CutPrefix(line, "+++ ")
+		if current == nil {
 			continue
 		}
 
 		if strings.HasPrefix(line, "@@") {
-			hunkLines = append(hunkLines, line)
+			finishHunk()
+			hunk_lines = append(hunk_lines, line)
 			continue
 		}
-
-		if len(hunkLines) > 0 {
-			hunkLines = append(hunkLines, line)
-		} else {
-			headers = append(headers, line)
+		if len(hunk_lines) > 0 {
+			hunk_lines = append(hunk_lines, line)
+			continue
 		}
-	}
 
-	if len(src) > 0 {
-		diffs = append(diffs, diff{
-			src:     src,
-			dst:     dst,
-			headers: headers,
-			hunk:    hunkLines,
-		})
+		current.headers = append(current.headers, line)
+		switch {
+		// Paths with spaces end with a tab on these lines
+		case strings.HasPrefix(line, "--- "):
+			current.src = unquotePath(strings.TrimSuffix(strings.TrimPrefix(line, "--- "), "\t"))
+		case strings.HasPrefix(line, "+++ "):
+			current.dst = unquotePath(strings.TrimSuffix(strings.TrimPrefix(line, "+++ "), "\t"))
+		case strings.HasPrefix(line, "old mode "):
+			current.oldMode = strings.TrimPrefix(line, "old mode ")
+		case strings.HasPrefix(line, "new mode "):
+			current.newMode = strings.TrimPrefix(line, "new mode ")
+		case strings.HasPrefix(line, "new file mode "):
+			current.src = "/dev/null"
+			current.newMode = strings.TrimPrefix(line, "new file mode ")
+		case strings.HasPrefix(line, "deleted file mode "):
+			current.dst = "/dev/null"
+			current.oldMode = strings.TrimPrefix(line, "deleted file mode ")
+		case strings.HasPrefix(line, "similarity index "):
+			current.similarity, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "similarity index "), "%"))
+		case strings.HasPrefix(line, "rename from "), strings.HasPrefix(line, "copy from "):
+			_, file, _ := strings.Cut(line, " from ")
+			current.src = "a/" + unquotePath(file)
+		case strings.HasPrefix(line, "rename to "), strings.HasPrefix(line, "copy to "):
+			_, file, _ := strings.Cut(line, " to ")
+			current.dst = "b/" + unquotePath(file)
+		case strings.HasPrefix(line, "index "):
+			// The mode is only on the index line when it didn't change
+			if fields := strings.Fields(line); len(fields) == 3 {
+				current.oldMode, current.newMode = fields[2], fields[2]
+			}
+		case strings.HasPrefix(line, "Binary files "), line == "GIT binary patch":
+			binary = true
+		}
 	}
+	finish()
 
 	return diffs
 }
@@ -0,0 +1,102 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Otard95/ngm/lib/slice"
+)
+
+// The widest the +/- bar of a file in a stat gets.
+const statBarWidth = 40
+
+// The lines added and deleted in a file, as listed by `git diff --numstat`.
+type fileStat struct {
+	file    string
+	added   int
+	deleted int
+	// Binary files have no lines to count
+	binary bool
+}
+
+func parseNumstat(raw string) []fileStat {
+	stats := []fileStat{}
+	for _, l := range strings.Split(raw, "\n") {
+		fields := strings.SplitN(l, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		stat := fileStat{file: fields[2]}
+		if fields[0] == "-" && fields[1] == "-" {
+			stat.binary = true
+		} else {
+			stat.added, _ = strconv.Atoi(fields[0])
+			stat.deleted, _ = strconv.Atoi(fields[1])
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+type diffSummary struct {
+	files      int
+	insertions int
+	deletions  int
+}
+
+func summarize(stats []fileStat) diffSummary {
+	summary := diffSummary{files: len(stats)}
+	for _, stat := range stats {
+		summary.insertions += stat.added
+		summary.deletions += stat.deleted
+	}
+	return summary
+}
+
+func (summary diffSummary) add(other diffSummary) diffSummary {
+	return diffSummary{
+		files:      summary.files + other.files,
+		insertions: summary.insertions + other.insertions,
+		deletions:  summary.deletions + other.deletions,
+	}
+}
+
+// Like the last line of `git diff --stat`.
+func (summary diffSummary) String() string {
+	plural := func(n int, word string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, word)
+		}
+		return fmt.Sprintf("%d %ss", n, word)
+	}
+	return plural(summary.files, "file") + " changed, " +
+		diffAdd.Render(plural(summary.insertions, "insertion")+"(+)") + ", " +
+		diffRemove.Render(plural(summary.deletions, "deletion")+"(-)")
+}
+
+// Lists the files with the number of changed lines and a bar of their additions
+// and deletions, like `git diff --stat`.
+func renderStats(stats []fileStat) string {
+	fileWidth, countWidth, most := 0, 0, 0
+	for _, stat := range stats {
+		fileWidth = max(fileWidth, len(stat.file))
+		countWidth = max(countWidth, len(strconv.Itoa(stat.added+stat.deleted)))
+		most = max(most, stat.added+stat.deleted)
+	}
+
+	return slice.Join(slice.Map(stats, func(stat fileStat, _ int) string {
+		line := " " + stat.file + strings.Repeat(" ", fileWidth-len(stat.file)) + " | "
+		if stat.binary {
+			return line + "Bin"
+		}
+		added, deleted := stat.added, stat.deleted
+		if most > statBarWidth {
+			added = (added*statBarWidth + most - 1) / most
+			deleted = (deleted*statBarWidth + most - 1) / most
+		}
+		return line + fmt.Sprintf("%*d ", countWidth, stat.added+stat.deleted) +
+			diffAdd.Render(strings.Repeat("+", added)) +
+			diffRemove.Render(strings.Repeat("-", deleted))
+	}), "\n")
+}
@@ -0,0 +1,32 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var numstatRaw = "3\t1\tgit/diff.go\n" +
+	"-\t-\timage.png\n" +
+	"0\t12\tREADME.md\n"
+
+func TestParseNumstat(t *testing.T) {
+	stats := parseNumstat(numstatRaw)
+
+	assert.Equal(t, []fileStat{
+		{file: "git/diff.go", added: 3, deleted: 1},
+		{file: "image.png", binary: true},
+		{file: "README.md", deleted: 12},
+	}, stats)
+	assert.Equal(t, diffSummary{files: 3, insertions: 3, deletions: 13}, summarize(stats))
+}
+
+func TestDiffOptionsArgs(t *testing.T) {
+	assert.Equal(t, []string{"HEAD"}, DiffOptions{}.args())
+	assert.Equal(t, []string{"--cached"}, DiffOptions{Cached: true}.args())
+	assert.Equal(
+		t,
+		[]string{"main...HEAD", "--", "git/", "*.md"},
+		DiffOptions{Refs: []string{"main...HEAD"}, Paths: []string{"git/", "*.md"}}.args(),
+	)
+}
@@ -0,0 +1,147 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/Otard95/ngm/lib/slice"
+	"github.com/stretchr/testify/assert"
+)
+
+var diffRaw = `diff --git a/bin.dat b/bin.dat
+index 8352675..1592e5c 100644
+Binary files a/bin.dat and b/bin.dat differ
+diff --git a/empty.txt b/empty.txt
+new file mode 100644
+index 0000000..e69de29
+diff --git a/mode.sh b/mode.sh
+old mode 100644
+new mode 100755
+diff --git a/old.txt b/new.txt
+similarity index 100%
+rename from old.txt
+rename to new.txt
+diff --git a/sub b/sub
+new file mode 160000
+index 0000000..1eccbe5
+--- /dev/null
++++ b/sub
+@@ -0,0 +1 @@
++Subproject commit 1eccbe5264cfab020aa0cb58a92e4d85b6b3aae3
+diff --git a/t.txt b/t.txt
+index 7a01701..f3ad7ff 100644
+--- a/t.txt
++++ b/t.txt
+@@ -1,2 +1,2 @@
+ x
+---y
++--z`
+
+func TestParseGitDiff(t *testing.T) {
+	diffs := parseGitDiff(&diffRaw)
+
+	assert.Equal(t, []string{"bin.dat", "empty.txt", "mode.sh", "new.txt", "sub", "t.txt"}, slice.Map(diffs, func(d diff, _ int) string {
+		return d.File()
+	}))
+	assert.Equal(t, []diffKind{DIFF_KIND_BINARY, DIFF_KIND_TEXT, DIFF_KIND_MODE, DIFF_KIND_RENAME, DIFF_KIND_SUBMODULE, DIFF_KIND_TEXT}, slice.Map(diffs, func(d diff, _ int) diffKind {
+		return d.kind
+	}))
+	assert.Equal(t, []string{
+		"bin.dat [binary]",
+		"empty.txt [added]",
+		"mode.sh",
+		"old.txt -> new.txt (100%)",
+		"sub [added] [submodule]",
+		"t.txt",
+	}, slice.Map(diffs, func(d diff, _ int) string { return d.Title() }))
+	assert.Equal(t, []string{
+		"Binary file changed",
+		"Empty file",
+		"Mode changed from 100644 to 100755",
+		"Renamed without changes",
+		"Submodule added at 1eccbe5",
+		"",
+	}, slice.Map(diffs, func(d diff, _ int) string { return d.Summary() }))
+
+	// Removed lines starting with "--" are part of the hunk
+	assert.Equal(t, []hunk{{
+		header:    "@@ -1,2 +1,2 @@",
+		oldStart:  1,
+		oldLength: 2,
+		newStart:  1,
+		newLength: 2,
+		parents:   1,
+		lines: []hunkLine{
+			{kind: HUNK_CONTEXT, prefix: " ", text: "x", oldLine: 1, newLine: 1},
+			{kind: HUNK_REMOVED, prefix: "-", text: "--y", oldLine: 2},
+			{kind: HUNK_ADDED, prefix: "+", text: "--z", newLine: 2},
+		},
+	}}, diffs[5].hunks)
+	assert.Equal(t, "diff --git a/t.txt b/t.txt\nindex 7a01701..f3ad7ff 100644\n--- a/t.txt\n+++ b/t.txt\n@@ -1,2 +1,2 @@\n x\n---y\n+--z", diffs[5].Patch())
+}
+
+func TestParseDiffPaths(t *testing.T) {
+	src, dst := parseDiffPaths("diff --git a/with b/space b/with b/space")
+	assert.Equal(t, "a/with b/space", src)
+	assert.Equal(t, "b/with b/space", dst)
+
+	src, dst = parseDiffPaths("diff --git a/old b/new")
+	assert.Equal(t, "a/old", src)
+	assert.Equal(t, "b/new", dst)
+
+	src, dst = parseDiffPaths("diff --cc conflict.txt")
+	assert.Equal(t, "a/conflict.txt", src)
+	assert.Equal(t, "b/conflict.txt", dst)
+
+	// Paths with special characters are quoted, and only one may be
+	src, dst = parseDiffPaths(`diff --git "a/t\303\251st.txt" "b/t\303\251st.txt"`)
+	assert.Equal(t, "a/tést.txt", src)
+	assert.Equal(t, "b/tést.txt", dst)
+
+	src, dst = parseDiffPaths(`diff --git a/plain "b/tab\there"`)
+	assert.Equal(t, "a/plain", src)
+	assert.Equal(t, "b/tab\there", dst)
+}
+
+func TestUnquotePath(t *testing.T) {
+	assert.Equal(t, "plain name", unquotePath("plain name"))
+	assert.Equal(t, "a/new\nline \"quoted\"", unquotePath(`"a/new\nline \"quoted\""`))
+	// Not a single quoted path, so it's left as is
+	assert.Equal(t, `"a/x" y`, unquotePath(`"a/x" y`))
+}
+
+func TestParseGitDiffSpecialPaths(t *testing.T) {
+	raw := "diff --git a/my file.txt b/my file.txt\nindex 7898192..422c2b7 100644\n--- a/my file.txt\t\n+++ b/my file.txt\t\n@@ -1 +1,2 @@\n a\n+b\n" +
+		"diff --git \"a/t\\303\\251st.txt\" \"b/t\\303\\251st.txt\"\nindex 7898192..422c2b7 100644\n--- \"a/t\\303\\251st.txt\"\n+++ \"b/t\\303\\251st.txt\"\n@@ -1 +1,2 @@\n a\n+b\n"
+	diffs := parseGitDiff(&raw)
+
+	assert.Equal(t, []string{"my file.txt", "tést.txt"}, slice.Map(diffs, func(d diff, _ int) string {
+		return d.File()
+	}))
+}
+
+func TestSubmoduleSummary(t *testing.T) {
+	raw := "diff --git a/sub b/sub\nindex 1eccbe5..1eccbe5 160000\n--- a/sub\n+++ b/sub\n@@ -1 +1 @@\n" +
+		"-Subproject commit 1eccbe5264cfab020aa0cb58a92e4d85b6b3aae3\n+Subproject commit 1eccbe5264cfab020aa0cb58a92e4d85b6b3aae3-dirty\n" +
+		"diff --git a/other b/other\nindex 1eccbe5..8352675 160000\n--- a/other\n+++ b/other\n@@ -1 +1 @@\n" +
+		"-Subproject commit 1eccbe5264cfab020aa0cb58a92e4d85b6b3aae3\n+Subproject commit 83526759d1f5b5e8c80a6bbc35c2ab6d6a71e1b4-dirty\n"
+	diffs := parseGitDiff(&raw)
+
+	assert.Equal(t, []string{
+		"Submodule has uncommitted changes at 1eccbe5",
+		"Submodule moved from 1eccbe5 to 8352675 and has uncommitted changes",
+	}, slice.Map(diffs, func(d diff, _ int) string { return d.Summary() }))
+}
+
+func TestRunDiffIgnoresWarnings(t *testing.T) {
+	dir := commitTestRepository(t)
+	// Makes git warn about the line endings of the changed file
+	assert.NoError(t, exec.Command("git", "-C", dir, "config", "core.autocrlf", "true").Run())
+	os.WriteFile(filepath.Join(dir, "file.txt"), []byte("c\n"), 0644)
+
+	out, err := runDiff(dir, DiffOptions{}, "--name-only")
+	assert.NoError(t, err)
+	assert.Equal(t, "file.txt\n", out)
+}
@@ -2,6 +2,7 @@ package git
 
 import (
 	"os"
+	"os/exec"
 	"path"
 	"strings"
 
@@ -25,6 +26,46 @@ func getDirectories(reindex bool) []string {
 	return dirs
 }
 
+// Adds the checked out submodules of each repository after it, and theirs, so
+// they're handled like nested repositories. Submodules aren't indexed since
+// their `.git` is a file, and they come and go with the commits of their
+// parent.
+func withSubmodules(dirs []string) []string {
+	result := []string{}
+	seen := map[string]bool{}
+	add := func(dir string) {
+		if !seen[path.Clean(dir)] {
+			seen[path.Clean(dir)] = true
+			result = append(result, dir)
+		}
+	}
+	for _, dir := range dirs {
+		add(dir)
+		for _, sub := range getSubmodules(dir) {
+			add(sub)
+		}
+	}
+	return result
+}
+
+// The paths of the checked out submodules of the repository, recursively.
+func getSubmodules(dir string) []string {
+	cmd := exec.Command("git", "-C", dir, "submodule", "foreach", "--quiet", "--recursive", `printf '%s\0' "$displaypath"`)
+	out, err := cmd.Output()
+	if err != nil {
+		log.Debugf("Failed to list the submodules of %s: %v\n", dir, err)
+		return nil
+	}
+
+	subs := []string{}
+	for _, sub := range strings.Split(string(out), "\x00") {
+		if len(sub) > 0 {
+			subs = append(subs, path.Join(dir, sub))
+		}
+	}
+	return subs
+}
+
 func findAllGitDirectories(basePath string) []string {
 	entries, err := os.ReadDir(basePath)
 	if err != nil {
@@ -0,0 +1,86 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Otard95/ngm/lib/slice"
+)
+
+// Resolves the editor the same way git does, minus `core.editor` which is per
+// repository and therefore ambiguous when committing to several at once.
+func getEditor() string {
+	for _, env := range []string{"GIT_EDITOR", "VISUAL", "EDITOR"} {
+		if editor := os.Getenv(env); len(editor) > 0 {
+			return editor
+		}
+	}
+	return "vi"
+}
+
+// Creates a command opening the provided file in the users editor. The editor
+// is run through the shell since it's common for it to contain arguments, e.g.
+// `code --wait`.
+func editorCommand(file string) *exec.Cmd {
+	return exec.Command("sh", "-c", getEditor()+` "$@"`, getEditor(), file)
+}
+
+// Builds the content of the commit message file, starting with the provided
+// message, or the repositories' `commit.template` if there is none.
+func commitTemplate(dirs []*directory, message string) string {
+	out := message
+	if len(out) == 0 {
+		out = getCommitTemplates(dirs)
+	}
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	out += "# Please enter the commit message for your changes. Lines starting\n"
+	out += "# with '#' will be ignored, and an empty message aborts the commit.\n"
+	out += "#\n"
+	out += "# Repositories to be committed:\n"
+	for _, dir := range dirs {
+		out += "#\n"
+		out += "#   " + dir.path + " (" + dir.stat.branch.name + ")\n"
+		out += slice.Join(
+			slice.Map(dir.stat.staged, func(c change, _ int) string {
+				return "#     " + c.kind.String() + ": " + c.file
+			}),
+			"\n",
+		) + "\n"
+	}
+	return out
+}
+
+// Writes the commit message file to the workspace directory, returning its
+// path.
+func writeCommitTemplate(dirs []*directory, message string) (string, error) {
+	file := workspaceFile("COMMIT_EDITMSG")
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(file, []byte(commitTemplate(dirs, message)), 0644)
+	return file, err
+}
+
+// Reads the commit message written by the editor.
+func readCommitMessage(file string) (string, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return cleanupMessage(string(content)), nil
+}
+
+// Drops comment lines and surrounding blank lines like
+// `git commit --cleanup=strip` does.
+func cleanupMessage(message string) string {
+	lines := slice.Filter(
+		strings.Split(strings.ReplaceAll(message, "\r\n", "\n"), "\n"),
+		func(l string, _ int) bool { return !strings.HasPrefix(l, "#") },
+	)
+	return strings.TrimSpace(slice.Join(lines, "\n"))
+}
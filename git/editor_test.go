@@ -0,0 +1,25 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitMessageFileIsInWorkspace(t *testing.T) {
+	cwd, _ := os.Getwd()
+	t.Cleanup(func() { os.Chdir(cwd) })
+	assert.NoError(t, os.Chdir(t.TempDir()))
+	root, _ := os.Getwd()
+
+	file, err := writeCommitTemplate(nil, "message")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, ".ngm", "COMMIT_EDITMSG"), file)
+	assert.Equal(t, filepath.Dir(configFiles()[0]), filepath.Dir(file))
+
+	content, err := readCommitMessage(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "message", content)
+}
@@ -0,0 +1,48 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/Otard95/ngm/lib/slice"
+)
+
+// Wraps the error of a failed git command with its output, which is where git
+// explains what went wrong.
+func commandError(out []byte, err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := strings.TrimSpace(string(out))
+	if len(msg) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w: %s", err, msg)
+}
+
+// Runs git, returning only what it writes to stdout so warnings don't end up in
+// what's parsed or exported. Exit codes in `ok` aren't failures.
+func gitOutput(dir string, stdin string, ok []int, args ...string) (string, error) {
+	cmd := exec.Command("git", slice.Concat([]string{"-C", dir}, args)...)
+	if len(stdin) > 0 {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	return commandOutput(cmd, ok)
+}
+
+// Like gitOutput, for commands that need more setup.
+func commandOutput(cmd *exec.Cmd, ok []int) (string, error) {
+	out, err := cmd.Output()
+	var exit_err *exec.ExitError
+	if errors.As(err, &exit_err) {
+		for _, code := range ok {
+			if exit_err.ExitCode() == code {
+				return string(out), nil
+			}
+		}
+		return string(out), commandError(exit_err.Stderr, err)
+	}
+	return string(out), err
+}
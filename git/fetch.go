@@ -0,0 +1,15 @@
+package git
+
+import (
+	"os/exec"
+
+	"github.com/Otard95/ngm/lib/slice"
+)
+
+func doFetch(dir string, userArgs []string) (string, error) {
+	args := slice.Concat([]string{"-C", dir, "fetch"}, userArgs)
+	cmd := exec.Command("git", args...)
+	out, err := cmd.CombinedOutput()
+	out_str := string(out)
+	return out_str, err
+}
@@ -0,0 +1,97 @@
+package git
+
+import (
+	"github.com/Otard95/ngm/lib/slice"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const fixupCommitCount = 10
+
+type fixupRow struct {
+	dir   *directory
+	entry *logEntry
+}
+
+// Lists the recent commits of each repository, letting the user pick which
+// commit the staged changes should fix up in each of them.
+type fixupPicker struct {
+	rows    []fixupRow
+	cursor  int
+	targets map[*directory]string
+}
+
+func newFixupPicker(dirs []*directory) fixupPicker {
+	logs := slice.ParallelMap(dirs, func(dir *directory, _ int) []logEntry {
+		entries, _ := getLog(dir.path, fixupCommitCount)
+		return entries
+	})
+
+	rows := []fixupRow{}
+	for i, dir := range dirs {
+		rows = append(rows, fixupRow{dir: dir})
+		for j := range logs[i] {
+			rows = append(rows, fixupRow{dir: dir, entry: &logs[i][j]})
+		}
+	}
+
+	picker := fixupPicker{rows: rows, targets: map[*directory]string{}}
+	picker.move(1)
+	return picker
+}
+
+// Moves the cursor, skipping the repository headers.
+func (picker *fixupPicker) move(delta int) {
+	for i := picker.cursor + delta; i >= 0 && i < len(picker.rows); i += delta {
+		if picker.rows[i].entry != nil {
+			picker.cursor = i
+			return
+		}
+	}
+}
+
+func (picker *fixupPicker) selectTarget() {
+	row := picker.rows[picker.cursor]
+	if row.entry == nil {
+		return
+	}
+	if picker.targets[row.dir] == row.entry.hash {
+		delete(picker.targets, row.dir)
+	} else {
+		picker.targets[row.dir] = row.entry.hash
+	}
+}
+
+func (picker *fixupPicker) Update(km keymap, msg tea.KeyMsg) {
+	switch {
+	case key.Matches(msg, km.up):
+		picker.move(-1)
+	case key.Matches(msg, km.down):
+		picker.move(1)
+	case key.Matches(msg, km.choose):
+		picker.selectTarget()
+	}
+}
+
+func (picker fixupPicker) View(height int) string {
+	lines := slice.Map(picker.rows, func(row fixupRow, i int) string {
+		if row.entry == nil {
+			return row.dir.path
+		}
+
+		text := "  [ ] " + row.entry.String()
+		if picker.targets[row.dir] == row.entry.hash {
+			text = staged_style.Render("  [x] " + row.entry.String())
+		}
+		if i == picker.cursor {
+			text = cursor_style.Render(text)
+		}
+		return text
+	})
+
+	if height <= 0 || len(lines) <= height {
+		return slice.Join(lines, "\n")
+	}
+	start := min(max(picker.cursor-height/2, 0), len(lines)-height)
+	return slice.Join(lines[start:start+height], "\n")
+}
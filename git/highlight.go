@@ -0,0 +1,180 @@
+package git
+
+import (
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Matches the colors of the rest of the UI.
+var highlightStyle = styles.Get("catppuccin-frappe")
+
+// The added and removed lines are marked by their background when they're
+// highlighted, since the text has the colors of the syntax.
+var (
+	diffAddBackground    = lipgloss.NewStyle().Background(lipgloss.Color("#4e5b56"))
+	diffRemoveBackground = lipgloss.NewStyle().Background(lipgloss.Color("#5e4755"))
+)
+
+// The lexer for the language of the file, or nil if it's not known.
+func fileLexer(file string) chroma.Lexer {
+	lexer := lexers.Match(file)
+	if lexer == nil {
+		return nil
+	}
+	return chroma.Coalesce(lexer)
+}
+
+// Splits the text into the tokens of each line.
+func tokenizeLines(lexer chroma.Lexer, lines []string) [][]chroma.Token {
+	if len(lines) == 0 {
+		return nil
+	}
+	iterator, err := lexer.Tokenise(nil, strings.Join(lines, "\n")+"\n")
+	if err != nil {
+		return nil
+	}
+	return chroma.SplitTokensIntoLines(iterator.Tokens())
+}
+
+// The base style with the colors of the token type.
+func tokenStyle(tokenType chroma.TokenType, base lipgloss.Style) lipgloss.Style {
+	style := base
+	entry := highlightStyle.Get(tokenType)
+	if entry.Colour.IsSet() {
+		style = style.Foreground(lipgloss.Color(entry.Colour.String()))
+	}
+	if entry.Bold == chroma.Yes {
+		style = style.Bold(true)
+	}
+	if entry.Italic == chroma.Yes {
+		style = style.Italic(true)
+	}
+	return style
+}
+
+func renderTokens(tokens []chroma.Token, base lipgloss.Style) string {
+	text := ""
+	for _, token := range tokens {
+		value := strings.TrimSuffix(token.Value, "\n")
+		if len(value) == 0 {
+			continue
+		}
+		text += tokenStyle(token.Type, base).Render(value)
+	}
+	return text
+}
+
+// Renders the lines of the hunk with the syntax of the file highlighted. The
+// old and new versions of the hunk are read separately, so constructs spanning
+// several lines are colored as they are in each version. Returns nil when the
+// language of the file isn't known.
+func highlightHunk(file string, h hunk) []string {
+	lexer := fileLexer(file)
+	if lexer == nil {
+		return nil
+	}
+
+	old, new := []string{}, []string{}
+	for _, l := range h.lines {
+		if l.oldLine > 0 {
+			old = append(old, l.text)
+		}
+		if l.newLine > 0 {
+			new = append(new, l.text)
+		}
+	}
+	old_tokens, new_tokens := tokenizeLines(lexer, old), tokenizeLines(lexer, new)
+
+	next := func(tokens *[][]chroma.Token) []chroma.Token {
+		if len(*tokens) == 0 {
+			return nil
+		}
+		line := (*tokens)[0]
+		*tokens = (*tokens)[1:]
+		return line
+	}
+	rendered := make([]string, len(h.lines))
+	for i, l := range h.lines {
+		switch l.kind {
+		case HUNK_REMOVED:
+			rendered[i] = diffRemoveBackground.Render(l.prefix) + renderTokens(next(&old_tokens), diffRemoveBackground)
+		case HUNK_ADDED:
+			// Lines of combined diffs can be added compared to one parent but
+			// already be in the first one, which is the old version
+			if l.oldLine > 0 {
+				next(&old_tokens)
+			}
+			rendered[i] = diffAddBackground.Render(l.prefix) + renderTokens(next(&new_tokens), diffAddBackground)
+		case HUNK_CONTEXT:
+			next(&old_tokens)
+			rendered[i] = l.prefix + renderTokens(next(&new_tokens), lipgloss.NewStyle())
+		default:
+			rendered[i] = diffUnchanged.Render(l.String())
+		}
+	}
+	return rendered
+}
+
+// Highlights the syntax of the sides of the rows, splitting the segments that
+// didn't change by token. The left and right sides are read separately, like
+// the old and new versions of the hunks. Changed words keep their colors.
+func highlightRows(file string, rows []sideRow) {
+	lexer := fileLexer(file)
+	if lexer == nil {
+		return
+	}
+
+	highlight := func(sideOf func(row *sideRow) *side) {
+		sides, lines := []*side{}, []string{}
+		for i := range rows {
+			s := sideOf(&rows[i])
+			if rows[i].isHeader || s.kind == SIDE_EMPTY {
+				continue
+			}
+			text := ""
+			for _, seg := range s.segments {
+				text += seg.text
+			}
+			sides, lines = append(sides, s), append(lines, text)
+		}
+		tokens := tokenizeLines(lexer, lines)
+		for i, s := range sides {
+			if i < len(tokens) {
+				s.segments = splitSegments(s.segments, tokens[i])
+			}
+		}
+	}
+	highlight(func(row *sideRow) *side { return &row.left })
+	highlight(func(row *sideRow) *side { return &row.right })
+}
+
+// Splits the segments of a line where its tokens start and end, leaving them as
+// they are if the tokens aren't of the same text.
+func splitSegments(segments []segment, tokens []chroma.Token) []segment {
+	split := []segment{}
+	i, offset := 0, 0
+	for _, seg := range segments {
+		rest := seg.text
+		for len(rest) > 0 {
+			if i == len(tokens) {
+				return segments
+			}
+			value := tokens[i].Value[offset:]
+			n := min(len(rest), len(value))
+			if value[:n] != rest[:n] {
+				return segments
+			}
+			split = append(split, segment{text: rest[:n], changed: seg.changed, highlighted: true, token: tokens[i].Type})
+			rest = rest[n:]
+			offset += n
+			if offset == len(tokens[i].Value) {
+				i, offset = i+1, 0
+			}
+		}
+	}
+	return split
+}
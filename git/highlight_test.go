@@ -0,0 +1,58 @@
+package git
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/Otard95/ngm/lib/slice"
+	"github.com/stretchr/testify/assert"
+)
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func TestHighlightHunk(t *testing.T) {
+	lines := []string{
+		" /* a",
+		"-comment */",
+		"+longer comment */",
+		" func main() {}",
+	}
+	h, _ := parseHunk(append([]string{"@@ -1,3 +1,3 @@"}, lines...))
+
+	assert.Nil(t, highlightHunk("file.unknown-extension", h))
+
+	highlighted := highlightHunk("main.go", h)
+	assert.Equal(t, lines, slice.Map(highlighted, func(l string, _ int) string {
+		return ansiEscape.ReplaceAllString(l, "")
+	}))
+}
+
+func TestHighlightRows(t *testing.T) {
+	h, _ := parseHunk([]string{
+		"@@ -1,3 +1,3 @@",
+		" /* a",
+		"-comment */",
+		"+longer comment */",
+		" func main() {}",
+	})
+	plain, highlighted := pairHunks([]hunk{h}), pairHunks([]hunk{h})
+	highlightRows("main.go", highlighted)
+	highlightRows("file.unknown-extension", plain)
+
+	for i := range plain {
+		assert.Equal(t,
+			ansiEscape.ReplaceAllString(plain[i].Render(60), ""),
+			ansiEscape.ReplaceAllString(highlighted[i].Render(60), ""),
+		)
+	}
+	changed := ""
+	for _, seg := range highlighted[2].right.segments {
+		if seg.changed {
+			changed += seg.text
+		}
+	}
+	assert.Equal(t, "longer ", changed)
+	assert.Greater(t, len(highlighted[3].left.segments), 1)
+	assert.True(t, highlighted[3].left.segments[0].highlighted)
+	assert.Len(t, plain[3].left.segments, 1)
+}
@@ -0,0 +1,179 @@
+package git
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Otard95/ngm/ui"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var diffGutter = lipgloss.NewStyle().Foreground(ui.ColorOverlay0)
+
+type hunkLineKind int
+
+const (
+	HUNK_CONTEXT hunkLineKind = iota
+	HUNK_ADDED
+	HUNK_REMOVED
+	// Notes about the line before it, like "\ No newline at end of file"
+	HUNK_NOTE
+	HUNK_LINE_KIND_COUNT
+)
+
+type hunkLine struct {
+	kind hunkLineKind
+	// The "+", "-" or " " before the text, one for each parent in combined diffs
+	prefix string
+	text   string
+	// The number of the line in the old and new file, 0 if it's not in that file
+	oldLine int
+	newLine int
+}
+
+func (l hunkLine) String() string {
+	return l.prefix + l.text
+}
+
+type hunk struct {
+	// The "@@ -1,2 +1,3 @@" line starting the hunk
+	header    string
+	oldStart  int
+	oldLength int
+	newStart  int
+	newLength int
+	// The heading git adds after the ranges, usually the enclosing function
+	section string
+	// How many versions the lines are compared to, more than one for merges
+	parents int
+	lines   []hunkLine
+}
+
+// Matches both "@@ -1,2 +1,3 @@" and the "@@@ -1,2 -1,2 +1,3 @@@" of combined
+// diffs, where only the first parent is kept as the old file.
+var hunkHeaderPattern = regexp.MustCompile(`^(@@+) -(\d+)(?:,(\d+))?(?: -\d+(?:,\d+)?)* \+(\d+)(?:,(\d+))? @@+(?: (.*))?$`)
+
+func parseHunkHeader(line string) (hunk, bool) {
+	match := hunkHeaderPattern.FindStringSubmatch(line)
+	if match == nil {
+		return hunk{}, false
+	}
+	number := func(s string) int {
+		// The length is left out when it's 1
+		if len(s) == 0 {
+			return 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	return hunk{
+		header:    line,
+		oldStart:  number(match[2]),
+		oldLength: number(match[3]),
+		newStart:  number(match[4]),
+		newLength: number(match[5]),
+		section:   match[6],
+		parents:   len(match[1]) - 1,
+	}, true
+}
+
+// Parses the lines of a hunk, the first being its header, numbering each line
+// by where it is in the old and new file.
+func parseHunk(lines []string) (hunk, bool) {
+	if len(lines) == 0 {
+		return hunk{}, false
+	}
+	h, ok := parseHunkHeader(lines[0])
+	if !ok {
+		return h, false
+	}
+
+	old, new := h.oldStart, h.newStart
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(line, "\\") {
+			h.lines = append(h.lines, hunkLine{kind: HUNK_NOTE, text: line})
+			continue
+		}
+		// Like the empty line left by the newline at the end of the diff
+		if len(line) < h.parents || strings.Trim(line[:h.parents], " +-") != "" {
+			continue
+		}
+
+		l := hunkLine{prefix: line[:h.parents], text: line[h.parents:]}
+		if l.prefix[0] != '+' {
+			l.oldLine = old
+			old++
+		}
+		switch {
+		case strings.Contains(l.prefix, "-"):
+			l.kind = HUNK_REMOVED
+		case strings.Contains(l.prefix, "+"):
+			l.kind = HUNK_ADDED
+		}
+		if l.kind != HUNK_REMOVED {
+			l.newLine = new
+			new++
+		}
+		h.lines = append(h.lines, l)
+	}
+	return h, true
+}
+
+// The header and lines of the hunk as git wrote them.
+func (h hunk) rawLines() []string {
+	lines := []string{h.header}
+	for _, l := range h.lines {
+		lines = append(lines, l.String())
+	}
+	return lines
+}
+
+// The width of the largest line number in the hunks.
+func gutterWidth(hunks []hunk) int {
+	most := 0
+	for _, h := range hunks {
+		most = max(most, h.oldStart+h.oldLength, h.newStart+h.newLength)
+	}
+	return len(strconv.Itoa(most))
+}
+
+// Renders the old and new line numbers of the line, blank for the versions of
+// the file it's not in.
+func renderGutter(l hunkLine, width int) string {
+	number := func(n int) string {
+		if n == 0 {
+			return strings.Repeat(" ", width)
+		}
+		return fmt.Sprintf("%*d", width, n)
+	}
+	return diffGutter.Render(number(l.oldLine) + " " + number(l.newLine) + " │ ")
+}
+
+// Renders the header and lines of the hunk with their line numbers in a gutter
+// of the width, highlighting the syntax when enabled and the language of the
+// file is known.
+func (h hunk) render(file string, gutter int, highlight bool) []string {
+	var highlighted []string
+	if highlight {
+		highlighted = highlightHunk(file, h)
+	}
+
+	rendered := []string{renderGutter(hunkLine{}, gutter) + diffHeader.Render(h.header)}
+	for i, l := range h.lines {
+		text := ""
+		switch {
+		case highlighted != nil:
+			text = highlighted[i]
+		case l.kind == HUNK_ADDED:
+			text = diffAdd.Render(l.String())
+		case l.kind == HUNK_REMOVED:
+			text = diffRemove.Render(l.String())
+		default:
+			text = diffUnchanged.Render(l.String())
+		}
+		rendered = append(rendered, renderGutter(l, gutter)+text)
+	}
+	return rendered
+}
@@ -0,0 +1,68 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHunkHeader(t *testing.T) {
+	h, ok := parseHunkHeader("@@ -10,7 +12,8 @@ func main() {")
+	assert.True(t, ok)
+	assert.Equal(t, hunk{
+		header:    "@@ -10,7 +12,8 @@ func main() {",
+		oldStart:  10,
+		oldLength: 7,
+		newStart:  12,
+		newLength: 8,
+		section:   "func main() {",
+		parents:   1,
+	}, h)
+
+	// The length is left out when it's 1
+	h, ok = parseHunkHeader("@@ -0,0 +1 @@")
+	assert.True(t, ok)
+	assert.Equal(t, []int{0, 0, 1, 1}, []int{h.oldStart, h.oldLength, h.newStart, h.newLength})
+
+	h, ok = parseHunkHeader("@@@ -1,2 -1,3 +1,4 @@@")
+	assert.True(t, ok)
+	assert.Equal(t, []int{1, 2, 1, 4, 2}, []int{h.oldStart, h.oldLength, h.newStart, h.newLength, h.parents})
+
+	_, ok = parseHunkHeader("@@ not a header @@")
+	assert.False(t, ok)
+}
+
+func TestParseHunk(t *testing.T) {
+	h, ok := parseHunk([]string{
+		"@@ -3,3 +3,3 @@",
+		" same",
+		"-old",
+		"\\ No newline at end of file",
+		"+new",
+		" last",
+		"",
+	})
+	assert.True(t, ok)
+	assert.Equal(t, []hunkLine{
+		{kind: HUNK_CONTEXT, prefix: " ", text: "same", oldLine: 3, newLine: 3},
+		{kind: HUNK_REMOVED, prefix: "-", text: "old", oldLine: 4},
+		{kind: HUNK_NOTE, text: "\\ No newline at end of file"},
+		{kind: HUNK_ADDED, prefix: "+", text: "new", newLine: 4},
+		{kind: HUNK_CONTEXT, prefix: " ", text: "last", oldLine: 5, newLine: 5},
+	}, h.lines)
+
+	// Lines of combined diffs are only in the old file if they're in the first parent
+	h, _ = parseHunk([]string{
+		"@@@ -1,1 -1,1 +1,2 @@@",
+		"  both",
+		"+ ours",
+		" +theirs",
+		"- gone",
+	})
+	assert.Equal(t, []hunkLine{
+		{kind: HUNK_CONTEXT, prefix: "  ", text: "both", oldLine: 1, newLine: 1},
+		{kind: HUNK_ADDED, prefix: "+ ", text: "ours", newLine: 2},
+		{kind: HUNK_ADDED, prefix: " +", text: "theirs", oldLine: 2, newLine: 3},
+		{kind: HUNK_REMOVED, prefix: "- ", text: "gone", oldLine: 3},
+	}, h.lines)
+}
@@ -11,7 +11,9 @@ import (
 	"github.com/Otard95/ngm/ui"
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	// "github.com/davecgh/go-spew/spew"
@@ -30,6 +32,11 @@ type line interface {
 type renderer interface {
 	Render() string
 }
+
+// Lines rendered to fit the width of the view.
+type widthRenderer interface {
+	RenderWidth(width int) string
+}
 type parented interface {
 	Parent() line
 }
@@ -38,6 +45,11 @@ type toggleable interface {
 	SetOpen(s bool)
 }
 
+// Lines showing a spinner while something is loading in the background.
+type loader interface {
+	Loading() bool
+}
+
 type childLine struct {
 	parent line
 }
@@ -74,8 +86,20 @@ type dirLine struct {
 }
 
 func (dirLine) isLine() {}
+func (d dirLine) Loading() bool {
+	return d.dir.loading || d.dir.operation != nil
+}
 func (d dirLine) Render() string {
-	return fmt.Sprintf("%s %s %s", d.text, d.dir.stat.Glance(), d.dir.stat.PrintBranchInfo())
+	text := d.text
+	if d.dir.err != nil {
+		text = fmt.Sprintf("%s %s", d.text, ui.ErrorStyle.Render("⨯ failed to read status"))
+	} else if d.dir.stat != nil {
+		text = fmt.Sprintf("%s %s %s", d.text, d.dir.stat.Glance(), d.dir.stat.PrintBranchInfo())
+	}
+	if d.dir.operation != nil {
+		text += " " + help_desc_style.Render(d.dir.operation.Progress())
+	}
+	return text
 }
 
 type untrackedLine struct {
@@ -116,6 +140,20 @@ func (s stagedLine) Render() string {
 	return s.text
 }
 
+// A row of a diff shown side by side, rendered to the width of the view.
+type sideBySideLine struct {
+	row sideRow
+	dir *directory
+	dif *diff
+	childLine
+}
+
+func (sideBySideLine) isLine() {}
+func (s sideBySideLine) RenderWidth(width int) string {
+	return s.row.Render(width)
+}
+
+// A line of a hunk, rendered with its line numbers.
 type diffLine struct {
 	text string
 	dir  *directory
@@ -125,27 +163,71 @@ type diffLine struct {
 
 func (diffLine) isLine() {}
 func (s diffLine) Render() string {
-	if strings.HasPrefix(s.text, "@") {
-		return diffHeader.Render(s.text)
+	return s.text
+}
+
+// Renders the line, fitting it to the width if it depends on it.
+func renderLine(l line, width int) (string, bool) {
+	switch v := l.(type) {
+	case widthRenderer:
+		return v.RenderWidth(width), true
+	case renderer:
+		return v.Render(), true
 	}
-	if strings.HasPrefix(s.text, "+") {
-		return diffAdd.Render(s.text)
+	return "", false
+}
+
+// Returns the directory the line belongs to.
+func lineDirectory(l line) *directory {
+	if dir_line, ok := l.(*dirLine); ok {
+		return dir_line.dir
 	}
-	if strings.HasPrefix(s.text, "-") {
-		return diffRemove.Render(s.text)
+	if parented_line, ok := l.(parented); ok {
+		return lineDirectory(parented_line.Parent())
 	}
-	return diffUnchanged.Render(s.text)
+	return nil
 }
 
-func lineChildren(parent line) []line {
+func lineChildren(parent line, options DiffOptions) []line {
 	switch v := parent.(type) {
 	case *dirLine:
+		if v.dir.stat == nil && v.dir.err == nil {
+			return []line{
+				textLine{text: "Loading…", childLine: childLine{parent: v}},
+				textLine{text: " ", childLine: childLine{parent: v}},
+			}
+		}
+		if v.dir.err != nil {
+			return append(
+				slice.Map(strings.Split(v.dir.err.Error(), "\n"), func(l string, _ int) line {
+					return textLine{text: ui.ErrorStyle.Render("  " + l), childLine: childLine{parent: v}}
+				}),
+				textLine{text: " ", childLine: childLine{parent: v}},
+			)
+		}
+
 		children := []line{}
+		countUnmerged := len(v.dir.stat.unmerged)
+		if countUnmerged > 0 {
+			children = slices.Concat(
+				children,
+				[]line{&sectionLine{text: fmt.Sprintf("Unmerged (%d)", countUnmerged), section: SECTION_UNMERGED, childLine: childLine{parent: v}}},
+				slice.Map(v.dir.stat.unmerged, func(change unmergedChange, i int) line {
+					return &unmergedLine{
+						dir:       v.dir,
+						change:    change,
+						childLine: childLine{parent: parent},
+					}
+				}),
+				[]line{textLine{text: " ", childLine: childLine{parent: v}}},
+			)
+		}
+
 		countUntracked := len(v.dir.stat.untracked)
 		if countUntracked > 0 {
 			children = slices.Concat(
 				children,
-				[]line{textLine{text: fmt.Sprintf("Untracked (%d)", countUntracked), childLine: childLine{parent: v}}},
+				[]line{&sectionLine{text: fmt.Sprintf("Untracked (%d)", countUntracked), section: SECTION_UNTRACKED, childLine: childLine{parent: v}}},
 				slice.Map(v.dir.stat.untracked, func(file_path string, i int) line {
 					return &untrackedLine{
 						text:      untracked_style.Render(fmt.Sprintf("  %s", file_path)),
@@ -162,7 +244,7 @@ func lineChildren(parent line) []line {
 		if countUnstaged > 0 {
 			children = slices.Concat(
 				children,
-				[]line{textLine{text: fmt.Sprintf("Unstaged (%d)", countUnstaged), childLine: childLine{parent: v}}},
+				[]line{&sectionLine{text: fmt.Sprintf("Unstaged (%d)", countUnstaged), section: SECTION_UNSTAGED, childLine: childLine{parent: v}}},
 				slice.Map(v.dir.stat.unstaged, func(change change, i int) line {
 					return &unstagedLine{
 						text:      unstaged_style.Render("  " + change.String()),
@@ -180,7 +262,7 @@ func lineChildren(parent line) []line {
 		if countStaged > 0 {
 			children = slices.Concat(
 				children,
-				[]line{textLine{text: fmt.Sprintf("Staged (%d)", countStaged), childLine: childLine{parent: v}}},
+				[]line{&sectionLine{text: fmt.Sprintf("Staged (%d)", countStaged), section: SECTION_STAGED, childLine: childLine{parent: v}}},
 				slice.Map(v.dir.stat.staged, func(change change, i int) line {
 					return &stagedLine{
 						text:      staged_style.Render("  " + change.String()),
@@ -200,47 +282,106 @@ func lineChildren(parent line) []line {
 				textLine{text: " ", childLine: childLine{parent: v}},
 			)
 		}
+
+		countStashes := len(v.dir.stashes)
+		if countStashes > 0 {
+			children = slices.Concat(
+				children,
+				[]line{&sectionLine{text: fmt.Sprintf("Stashes (%d)", countStashes), section: SECTION_STASHES, childLine: childLine{parent: v}}},
+				slice.Map(v.dir.stashes, func(stash stashEntry, i int) line {
+					return &stashLine{
+						dir:       v.dir,
+						stash:     stash,
+						childLine: childLine{parent: parent},
+					}
+				}),
+				[]line{textLine{text: " ", childLine: childLine{parent: v}}},
+			)
+		}
 		return children
 
 	case *unstagedLine:
-		dif := slice.Find(v.dir.dif, func(diff diff) bool { return diff.src == ("a/" + v.change.file) })
-		if dif == nil {
-			return []line{&textLine{
-				text:      "   No diff",
-				childLine: childLine{parent: v},
-			}}
-		}
-		return slice.Map(dif.hunk, func(hunk_line string, i int) line {
-			return &diffLine{
-				text:      hunk_line,
-				dir:       v.dir,
-				dif:       dif,
-				childLine: childLine{parent: v},
-			}
-		})
+		return diffLines(v, v.dir, v.change.file, options)
 
 	case *stagedLine:
-		dif := slice.Find(v.dir.dif, func(diff diff) bool { return diff.src == ("a/" + v.change.file) })
-		if dif == nil {
-			return []line{&textLine{
-				text:      "   No diff",
-				childLine: childLine{parent: v},
-			}}
+		return diffLines(v, v.dir, v.change.file, options)
+
+	case *unmergedLine:
+		return conflictLines(v)
+
+	case *stashLine:
+		stash_diff, ok := v.dir.stashDiffs[v.stash.ref]
+		if !ok || stash_diff.loading {
+			return []line{&textLine{text: "  Loading stash…", childLine: childLine{parent: v}}}
 		}
-		return slice.Map(dif.hunk, func(hunk_line string, i int) line {
-			return &diffLine{
-				text:      hunk_line,
-				dir:       v.dir,
-				dif:       dif,
-				childLine: childLine{parent: v},
-			}
-		})
+		return changeLines(v, v.dir, stash_diff.dif, stash_diff.err, options)
 	}
 	return []line{}
 }
 
-type keymap = struct {
-	down, up, toggle, stage, unstage, commit, help, quit key.Binding
+func diffLines(parent line, dir *directory, file string, options DiffOptions) []line {
+	if !dir.difLoaded {
+		return []line{&textLine{
+			text:      "   Loading diff…",
+			childLine: childLine{parent: parent},
+		}}
+	}
+
+	dif := slice.Find(dir.dif, func(diff diff) bool { return diff.File() == file })
+	if dif == nil {
+		return []line{&textLine{
+			text:      "   No diff",
+			childLine: childLine{parent: parent},
+		}}
+	}
+	return hunkLines(parent, dir, dif, options)
+}
+
+// The lines of the hunks of the diff, one for each row when shown side by side.
+func hunkLines(parent line, dir *directory, dif *diff, options DiffOptions) []line {
+	if summary := dif.Summary(); len(summary) > 0 {
+		return []line{&textLine{text: "   " + diffUnchanged.Render(summary), childLine: childLine{parent: parent}}}
+	}
+	if options.SideBySide {
+		rows := pairHunks(dif.hunks)
+		if options.Highlight {
+			highlightRows(dif.File(), rows)
+		}
+		return slice.Map(rows, func(row sideRow, _ int) line {
+			return &sideBySideLine{row: row, dir: dir, dif: dif, childLine: childLine{parent: parent}}
+		})
+	}
+	lines := []line{}
+	gutter := gutterWidth(dif.hunks)
+	for _, h := range dif.hunks {
+		for _, text := range h.render(dif.File(), gutter, options.Highlight) {
+			lines = append(lines, &diffLine{text: text, dir: dir, dif: dif, childLine: childLine{parent: parent}})
+		}
+	}
+	return lines
+}
+
+// The lines of each file in the diffs, like the changes of a commit or a stash,
+// each headed by the file name.
+func changeLines(parent line, dir *directory, difs []diff, err error, options DiffOptions) []line {
+	if err != nil {
+		return slice.Map(strings.Split(err.Error(), "\n"), func(l string, _ int) line {
+			return &textLine{text: ui.ErrorStyle.Render("  " + l), childLine: childLine{parent: parent}}
+		})
+	}
+	if len(difs) == 0 {
+		return []line{&textLine{text: "  No changes", childLine: childLine{parent: parent}}}
+	}
+
+	children := []line{}
+	for i := range difs {
+		children = append(children, &textLine{
+			text:      "  " + diffHeader.Render(difs[i].Title()),
+			childLine: childLine{parent: parent},
+		})
+		children = append(children, hunkLines(parent, dir, &difs[i], options)...)
+	}
+	return append(children, &textLine{text: " ", childLine: childLine{parent: parent}})
 }
 
 type model struct {
@@ -256,6 +397,96 @@ type model struct {
 	committing  bool
 	afterCommit bool
 	textInput   textarea.Model
+	// When enabled in the workspace config the commit form is used in place of
+	// the free text commit message
+	conventional  bool
+	commitTypes   []string
+	commitForm    commitForm
+	commitOptions commitOptions
+	// The message loaded when amending, to tell whether it was changed
+	amendMessage string
+	// The `commit.template` the message started from, which is rejected if it
+	// isn't edited
+	template     string
+	fixingUp     bool
+	fixup        fixupPicker
+	notification *notification
+	watcher      *watcher
+	spinner      spinner.Model
+	spinning     bool
+	searching    bool
+	searchInput  textinput.Model
+	matches      []searchMatch
+	matchIndex   int
+	filter       dirFilter
+	branching    bool
+	branches     branchPanel
+	viewingLog   bool
+	log          logPane
+	stashing     bool
+	stashInput   textinput.Model
+	stashDirs    []*directory
+	confirmation *confirmation
+	selection    map[selectionKey]bool
+	pendingClick *pendingClick
+	diffOptions  DiffOptions
+	clicks       int
+}
+
+type notification struct {
+	text string
+	err  bool
+}
+
+func (model *model) notify(text string) {
+	model.notification = &notification{text: text}
+}
+
+// Shows the error, adding to any errors already shown since the last key press.
+func (model *model) notifyError(err error) {
+	if model.notification != nil && model.notification.err {
+		model.notification.text += "\n" + err.Error()
+		return
+	}
+	model.notification = &notification{text: err.Error(), err: true}
+}
+
+// An action waiting for the user to confirm it. Once run, the repositories it
+// affects are refreshed.
+type confirmation struct {
+	text   string
+	dirs   []*directory
+	action func() error
+}
+
+func (model *model) confirm(text string, dirs []*directory, action func() error) {
+	model.confirmation = &confirmation{text: text, dirs: dirs, action: action}
+}
+
+func (model *model) runConfirmation(c *confirmation) tea.Cmd {
+	if err := c.action(); err != nil {
+		model.notifyError(err)
+	}
+	return tea.Batch(slice.Map(c.dirs, func(dir *directory, _ int) tea.Cmd {
+		return model.refresh(dir.path)
+	})...)
+}
+
+func (model *model) confirmationView() string {
+	if model.confirmation == nil {
+		return ""
+	}
+	return help_key_style.Render(" " + model.confirmation.text + " (y/n)")
+}
+
+func (model *model) notificationView() string {
+	if model.notification == nil {
+		return ""
+	}
+	if model.notification.err {
+		return ui.ErrorStyle.Render(" " + model.notification.text)
+	}
+	return help_key_style.Render(" " + model.notification.text)
 }
 
 func (model *model) up() {
@@ -278,20 +509,41 @@ func (model *model) down() {
 	}
 }
 
-func (model *model) toggleLine() {
+func (model *model) scrollToCursor() {
+	// Keep the cursor at least 5 lines from the top and bottom
+	if model.scroll > model.cursor-5 {
+		model.scroll = max(model.cursor-5, 0)
+	}
+	if model.scroll+model.height < model.cursor+5 {
+		model.scroll = model.cursor + 5 - model.height
+	}
+}
+
+// Opens or closes the line under the cursor. Returns a command loading the
+// diff of the repository when a file is opened before it has been read.
+func (model *model) toggleLine() tea.Cmd {
+	if len(model.lines) == 0 {
+		return nil
+	}
 	line := model.lines[model.cursor]
 	if toggle_line, ok := line.(toggleable); ok {
 		if toggle_line.Open() {
 			model.closeLine(line)
 			toggle_line.SetOpen(false)
-			return
+			return nil
 		}
 		toggle_line.SetOpen(true)
 		model.lines = slices.Insert(
 			model.lines,
 			model.cursor+1,
-			lineChildren(line)...,
+			lineChildren(line, model.diffOptions)...,
 		)
+		switch v := line.(type) {
+		case *unstagedLine, *stagedLine:
+			return model.loadDiff(lineDirectory(line))
+		case *stashLine:
+			return model.loadStashDiff(v.dir, v.stash.ref)
+		}
 	} else if parented_line, ok := line.(parented); ok {
 		i := slices.Index(model.lines, parented_line.Parent())
 		if i != -1 {
@@ -300,9 +552,33 @@ func (model *model) toggleLine() {
 			if model.scroll > model.cursor-5 {
 				model.scroll = max(model.cursor-5, 0)
 			}
-			model.toggleLine()
+			return model.toggleLine()
+		}
+	}
+	return nil
+}
+
+// Switches between showing diffs unified and side by side, re-creating the
+// open diffs.
+func (model *model) toggleSideBySide() {
+	model.diffOptions.SideBySide = !model.diffOptions.SideBySide
+	if model.diffOptions.SideBySide {
+		model.notify("Showing diffs side by side")
+	} else {
+		model.notify("Showing diffs unified")
+	}
+
+	// The rows of the diffs change, so the cursor is kept on the file instead
+	if len(model.lines) > 0 {
+		switch current := model.lines[model.cursor].(type) {
+		case *diffLine, *sideBySideLine:
+			model.cursor = max(slices.Index(model.lines, current.(parented).Parent()), 0)
 		}
 	}
+	for _, dir := range model.directories {
+		model.rebuildDirectory(dir)
+	}
+	model.scrollToCursor()
 }
 
 func (model *model) closeLine(lineToClose line) {
@@ -324,106 +600,22 @@ func (model *model) closeLine(lineToClose line) {
 	})
 }
 
-func (model *model) stage() {
-	current_line := model.lines[model.cursor]
-	var (
-		parent line
-		dir    *directory
-	)
-	if unstaged, ok := current_line.(*unstagedLine); ok {
-		err := stageChange(unstaged.dir.path, unstaged.change)
-		if err != nil {
-			panic(err)
-		}
-
-		parent = unstaged.parent
-		dir = unstaged.dir
+// Reloads the status of the directory and re-renders the children of its line.
+func (model *model) refreshStatus(dir *directory) tea.Cmd {
+	if err := dir.loadStatus(); err != nil {
+		model.notifyError(fmt.Errorf("Failed to read the status of %s: %w", dir.path, err))
 	}
-
-	if untracked, ok := current_line.(*untrackedLine); ok {
-		err := stagePath(untracked.dir.path, untracked.file)
-		if err != nil {
-			panic(err)
-		}
-
-		parent = untracked.parent
-		dir = untracked.dir
-	}
-
-	if parent != nil && dir != nil {
-		stat, err := getStatus(dir.path)
-		if err != nil {
-			panic(err)
-		}
-		dir.stat = stat
-
-		prev_cursor := model.cursor
-		model.cursor = slices.Index(model.lines, parent)
-		model.toggleLine()
-		model.toggleLine()
-		model.cursor = min(prev_cursor, len(model.lines)-1)
+	cmd := model.invalidateDiff(dir)
+	model.rebuildDirectory(dir)
+	if model.filter != FILTER_NONE {
+		model.applyFilter()
 	}
+	return cmd
 }
 
-func (model *model) unstage() {
-	current_line := model.lines[model.cursor]
-	if staged, ok := current_line.(*stagedLine); ok {
-		err := unstageChange(staged.dir.path, staged.change)
-		if err != nil {
-			panic(err)
-		}
-
-		stat, err := getStatus(staged.dir.path)
-		if err != nil {
-			panic(err)
-		}
-		staged.dir.stat = stat
-
-		prev_cursor := model.cursor
-		model.cursor = slices.Index(model.lines, staged.parent)
-		model.toggleLine()
-		model.toggleLine()
-		model.cursor = min(prev_cursor, len(model.lines)-1)
-	}
-}
-
-type commitResult struct {
-	text string
-	path string
-	ok   bool
-}
-
-func (model *model) commit(message string) []commitResult {
-	return slice.ParallelMap(
-		slice.Filter(model.directories, func(dir *directory, _ int) bool {
-			return len(dir.stat.staged) > 0
-		}),
-		func(dir *directory, _ int) commitResult {
-			result, err := doCommit(dir.path, message)
-			return commitResult{
-				text: result,
-				path: dir.path,
-				ok:   err == nil,
-			}
-		},
-	)
-}
-
-func (model *model) reset() {
-	dirs := slice.ParallelMap(
-		slice.Map(model.directories, func(dir *directory, _ int) string { return dir.path }),
-		func(path string, _ int) *directory {
-			stat, _ := getStatus(path)
-			dif, _ := getDiff(path)
-			return &directory{
-				path: path,
-				stat: stat,
-				dif:  dif,
-			}
-		},
-	)
-	model.directories = dirs
-	model.lines = slice.Map(dirs, func(dir *directory, _ int) line {
+// Reloads every repository and returns to the initial view.
+func (model *model) reset() tea.Cmd {
+	model.lines = slice.Map(model.directories, func(dir *directory, _ int) line {
 		return &dirLine{
 			text: dir.path,
 			dir:  dir,
@@ -434,8 +626,17 @@ func (model *model) reset() {
 	model.scroll = 0
 	model.committing = false
 	model.afterCommit = false
+	model.fixingUp = false
+	model.commitOptions = commitOptions{}
+	model.amendMessage = ""
+	model.template = ""
+	model.notification = nil
+	model.clearSelection()
 	model.textInput.Reset()
 	model.textInput.Blur()
+	model.endSearch(false)
+	model.applyFilter()
+	return model.refreshAll()
 }
 
 func newTextarea() textarea.Model {
@@ -455,12 +656,18 @@ func newTextarea() textarea.Model {
 }
 
 func initialModel(directories []*directory) model {
+	km, keymapErr := loadKeymap()
+
 	help := help.New()
 	help.Styles.ShortKey = help_key_style
 	help.Styles.ShortDesc = help_desc_style
 	help.Styles.ShortSeparator = lipgloss.NewStyle().Foreground(ui.ColorOverlay0)
 
-	return model{
+	loading := spinner.New()
+	loading.Spinner = spinner.Points
+	loading.Style = lipgloss.NewStyle().Foreground(ui.ColorTeal)
+
+	m := model{
 		directories: directories,
 		cursor:      0,
 		lines: slice.Map(directories, func(dir *directory, _ int) line {
@@ -469,86 +676,116 @@ func initialModel(directories []*directory) model {
 				dir:  dir,
 			}
 		}),
-		textInput: newTextarea(),
-		help:      help,
-		keymap: keymap{
-			help: key.NewBinding(
-				key.WithKeys("h"),
-				key.WithHelp("h", "help"),
-			),
-			quit: key.NewBinding(
-				key.WithKeys("q", "ctrl+c"),
-				key.WithHelp("q", "quit"),
-			),
-			toggle: key.NewBinding(
-				key.WithKeys("tab", "space", "="),
-				key.WithHelp("space/tab", "toggle"),
-			),
-			up: key.NewBinding(
-				key.WithKeys("up", "k"),
-				key.WithHelp("↑", "up"),
-			),
-			down: key.NewBinding(
-				key.WithKeys("down", "j"),
-				key.WithHelp("↓", "down"),
-			),
-			unstage: key.NewBinding(
-				key.WithKeys("u"),
-				key.WithHelp("u", "unstage"),
-			),
-			stage: key.NewBinding(
-				key.WithKeys("s"),
-				key.WithHelp("s", "stage"),
-			),
-			commit: key.NewBinding(
-				key.WithKeys("c"),
-				key.WithHelp("c", "commit"),
-			),
-		},
+		textInput:    newTextarea(),
+		searchInput:  newSearchInput(),
+		stashInput:   newStashInput(),
+		conventional: getConfigBool("commit.conventional"),
+		commitTypes:  conventionalTypes(),
+		help:         help,
+		spinner:      loading,
+		// `Init` starts the spinner while the repositories load
+		spinning: true,
+		keymap:   km,
 	}
+	if keymapErr != nil {
+		m.notifyError(keymapErr)
+	}
+	return m
 }
 
 func (model model) Init() tea.Cmd {
-	return textarea.Blink
+	cmds := []tea.Cmd{textarea.Blink, model.spinner.Tick}
+	for _, dir := range model.directories {
+		cmds = append(cmds, loadDirectoryCmd(dir.path, dir.loadGeneration))
+	}
+	if model.watcher != nil {
+		cmds = append(cmds, model.watcher.Wait())
+	}
+	return tea.Batch(cmds...)
 }
 
 func (model model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	justStartedCommitting := false
+	skipInput := false
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		if model.committing {
 			switch msg.String() {
 			case "ctrl+c":
-				result := model.commit(model.textInput.Value())
-				model.textInput.SetValue(slice.Join(slice.Map(
-					result,
-					func(res commitResult, _ int) string {
-						out := ""
-						if res.ok {
-							out = "[OK]"
-						} else {
-							out = "[ERROR]"
-						}
-
-						out += res.path + "\n" + res.text + "\n\n"
-						return out
-					},
-				), "\n"))
-				model.textInput.Blur()
-				model.committing = false
-				model.afterCommit = true
+				model.submitCommit()
+			case "esc":
+				model.cancelCommit()
+			default:
+				skipInput = model.toggleCommitOption(msg)
+			}
+		} else if model.confirmation != nil {
+			confirmation := model.confirmation
+			model.confirmation = nil
+			if msg.String() == "y" {
+				return model, model.runConfirmation(confirmation)
+			}
+			return model, nil
+		} else if model.stashing {
+			switch msg.String() {
+			case "enter":
+				return model, model.submitStash()
+			case "esc":
+				model.cancelStash()
+			default:
+				var cmd tea.Cmd
+				model.stashInput, cmd = model.stashInput.Update(msg)
+				return model, cmd
 			}
+			skipInput = true
+		} else if model.searching {
+			switch msg.String() {
+			case "enter":
+				model.endSearch(true)
+			case "esc":
+				model.endSearch(false)
+			default:
+				var cmd tea.Cmd
+				model.searchInput, cmd = model.searchInput.Update(msg)
+				model.updateSearch()
+				return model, cmd
+			}
+			skipInput = true
+		} else if model.branching {
+			return model, model.updateBranches(msg)
+		} else if model.viewingLog {
+			switch msg.String() {
+			case "esc", "q":
+				model.viewingLog = false
+			default:
+				model.log.Update(model.keymap, msg)
+			}
+			skipInput = true
+		} else if model.fixingUp {
+			model.notification = nil
+			switch msg.String() {
+			case "ctrl+c", "c":
+				model.commitFixups()
+			case "esc", "q":
+				model.cancelFixup()
+			default:
+				model.fixup.Update(model.keymap, msg)
+			}
+			skipInput = true
 		} else if model.afterCommit {
 			switch msg.String() {
 			case "ctrl+c":
-				model.reset()
+				return model, model.reset()
 			}
 		} else {
+			model.notification = nil
+
 			switch {
 			case key.Matches(msg, model.keymap.quit):
 				return model, tea.Quit
 
+			case key.Matches(msg, model.keymap.clearSelection):
+				model.clearSelection()
+
 			case key.Matches(msg, model.keymap.up):
 				model.up()
 
@@ -556,18 +793,124 @@ func (model model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				model.down()
 
 			case key.Matches(msg, model.keymap.toggle):
-				model.toggleLine()
+				return model, model.toggleLine()
 
 			case key.Matches(msg, model.keymap.stage):
-				model.stage()
+				return model, model.stage()
 
 			case key.Matches(msg, model.keymap.unstage):
-				model.unstage()
+				return model, model.unstage()
 
 			case key.Matches(msg, model.keymap.commit):
-				model.committing = true
-				justStartedCommitting = true
-				model.textInput.Focus()
+				model.startCommit()
+				skipInput = true
+
+			case key.Matches(msg, model.keymap.amend):
+				model.commitOptions.amend = true
+				model.startCommit()
+				skipInput = true
+
+			case key.Matches(msg, model.keymap.fixup):
+				model.startFixup()
+
+			case key.Matches(msg, model.keymap.sideBySide):
+				model.toggleSideBySide()
+
+			case key.Matches(msg, model.keymap.refresh):
+				return model, model.refreshAll()
+
+			case key.Matches(msg, model.keymap.search):
+				model.startSearch()
+				skipInput = true
+
+			case key.Matches(msg, model.keymap.nextMatch):
+				model.nextMatch(1)
+
+			case key.Matches(msg, model.keymap.prevMatch):
+				model.nextMatch(-1)
+
+			case key.Matches(msg, model.keymap.filter):
+				model.cycleFilter()
+
+			case key.Matches(msg, model.keymap.push):
+				return model, model.remoteCursor(PUSH)
+
+			case key.Matches(msg, model.keymap.pushAll):
+				return model, model.remoteAll(PUSH)
+
+			case key.Matches(msg, model.keymap.pull):
+				return model, model.remoteCursor(PULL)
+
+			case key.Matches(msg, model.keymap.pullAll):
+				return model, model.remoteAll(PULL)
+
+			case key.Matches(msg, model.keymap.fetch):
+				return model, model.remoteCursor(FETCH)
+
+			case key.Matches(msg, model.keymap.fetchAll):
+				return model, model.remoteAll(FETCH)
+
+			case key.Matches(msg, model.keymap.branch):
+				if len(model.lines) > 0 {
+					model.openBranches([]*directory{lineDirectory(model.lines[model.cursor])})
+				}
+
+			case key.Matches(msg, model.keymap.branchAll):
+				model.openBranches(model.selectedOrShownDirectories())
+
+			case key.Matches(msg, model.keymap.log):
+				if len(model.lines) > 0 {
+					model.openLog([]*directory{lineDirectory(model.lines[model.cursor])})
+				}
+
+			case key.Matches(msg, model.keymap.logAll):
+				model.openLog(model.selectedOrShownDirectories())
+
+			case key.Matches(msg, model.keymap.stash):
+				if len(model.lines) > 0 {
+					model.startStash([]*directory{lineDirectory(model.lines[model.cursor])})
+				}
+				skipInput = true
+
+			case key.Matches(msg, model.keymap.stashAll):
+				model.startStash(model.selectedOrShownDirectories())
+				skipInput = true
+
+			case key.Matches(msg, model.keymap.apply):
+				return model, model.stashAction("apply", doStashApply)
+
+			case key.Matches(msg, model.keymap.pop):
+				return model, model.stashAction("pop", doStashPop)
+
+			case key.Matches(msg, model.keymap.drop):
+				model.dropStash()
+
+			case key.Matches(msg, model.keymap.selectLine):
+				model.toggleSelection()
+
+			case key.Matches(msg, model.keymap.selectSection):
+				model.selectSection()
+
+			case key.Matches(msg, model.keymap.selectMatches):
+				model.selectMatches()
+
+			case key.Matches(msg, model.keymap.discard):
+				model.discard()
+
+			case key.Matches(msg, model.keymap.ours):
+				model.resolveConflict(OURS)
+
+			case key.Matches(msg, model.keymap.theirs):
+				model.resolveConflict(THEIRS)
+
+			case key.Matches(msg, model.keymap.edit):
+				return model, model.editConflict(false)
+
+			case key.Matches(msg, model.keymap.mergetool):
+				return model, model.editConflict(true)
+
+			case key.Matches(msg, model.keymap.commitEditor):
+				return model, model.commitWithEditor()
 
 			case key.Matches(msg, model.keymap.help):
 				model.showHelp = !model.showHelp
@@ -575,35 +918,98 @@ func (model model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
+	case tea.MouseMsg:
+		if !model.showHelp && !model.committing && model.confirmation == nil && !model.stashing &&
+			!model.searching && !model.branching && !model.viewingLog && !model.fixingUp && !model.afterCommit {
+			return model, model.mouse(msg)
+		}
+		return model, nil
+
+	case clickTimeoutMsg:
+		return model, model.clickTimeout(msg)
+
+	case editorFinishedMsg:
+		model.editorFinished(msg)
+
+	case conflictEditedMsg:
+		return model, model.conflictEdited(msg)
+
+	case directoryLoadedMsg:
+		return model, model.directoryLoaded(msg)
+
+	case diffLoadedMsg:
+		return model, model.diffLoaded(msg)
+
+	case stashDiffLoadedMsg:
+		model.stashDiffLoaded(msg)
+
+	case remoteDoneMsg:
+		return model, model.remoteDone(msg)
+
+	case spinner.TickMsg:
+		if !model.isLoading() {
+			model.spinning = false
+			return model, nil
+		}
+		var cmd tea.Cmd
+		model.spinner, cmd = model.spinner.Update(msg)
+		return model, cmd
+
+	case directoryChangedMsg:
+		return model, tea.Batch(model.refresh(msg.path), model.watcher.Wait())
+
 	case tea.WindowSizeMsg:
 		model.width = msg.Width
 		model.height = msg.Height
 		model.textInput.SetWidth(model.width)
 		model.textInput.SetHeight(min(model.height-1, 20))
+		if model.committing && model.conventional {
+			model.commitForm.SetWidth(model.width)
+		}
 	}
 
-	if justStartedCommitting {
+	if skipInput {
 		msg = nil
 	}
-	newTextInput, cmd := model.textInput.Update(msg)
-	model.textInput = newTextInput
+	var cmd tea.Cmd
+	if model.committing && model.conventional {
+		cmd = model.commitForm.Update(msg)
+	} else {
+		model.textInput, cmd = model.textInput.Update(msg)
+	}
 
 	return model, cmd
 }
 
 func (model model) View() string {
 	if model.showHelp {
-		return `
-  Key        | Alt key | Action
-  -----------|---------|-------
-  Ctrl+c     | q       | Quit
-  Arrow Up   | k       | Move the cursor up
-  Arrow Down | j       | Move the cursor Down
-  Tab        | Space   | Open/close the line under the cursor
-  s          |         | Stage the change under the cursor
-  u          |         | Unstage the change under the cursor
-  h          |         | Toggle this help screen`
-	} else if model.committing || model.afterCommit {
+		return model.keymap.helpView()
+	} else if model.committing && model.conventional {
+		return model.commitForm.View() + "\n" + model.commitOptionsView() +
+			"\nTab/Shift+tab to change field, Ctrl+c to commit, Esc to cancel"
+	} else if model.committing {
+		return model.textInput.View() + "\n" + model.commitOptionsView() +
+			"\nCtrl+c to commit, Esc to cancel"
+	} else if model.branching {
+		view := model.branches.View(model.keymap, model.height-6)
+		if footer := model.footerView(); len(footer) > 0 {
+			view += "\n" + footer
+		}
+		return view
+	} else if model.viewingLog {
+		view := model.log.View(model.width, model.height-4)
+		if footer := model.footerView(); len(footer) > 0 {
+			view += "\n" + footer
+		}
+		return view
+	} else if model.fixingUp {
+		view := model.fixup.View(model.height-2) +
+			"\n" + model.keymap.choose.Help().Key + " to select the commit to fix up, Ctrl+c to commit, Esc to cancel"
+		if footer := model.footerView(); len(footer) > 0 {
+			view += "\n" + footer
+		}
+		return view
+	} else if model.afterCommit {
 		return model.textInput.View() + "\nCtrl+c to continue"
 	} else {
 		lines := []string{fmt.Sprintf(
@@ -617,9 +1023,23 @@ func (model model) View() string {
 			}),
 		)}
 
+		// Leave room for the selection gutter
+		width := model.width
+		if len(model.selection) > 0 {
+			width--
+		}
 		for i, line := range model.lines {
-			if l, ok := line.(renderer); ok {
-				text := l.Render()
+			if text, ok := renderLine(line, width); ok {
+				if l, ok := line.(loader); ok && l.Loading() {
+					text += " " + model.spinner.View()
+				}
+				// Selected lines are marked in a gutter that's only there while
+				// anything is selected
+				if model.isSelected(line) {
+					text = selected_style.Render("▌") + text
+				} else if len(model.selection) > 0 {
+					text = " " + text
+				}
 				if i == model.cursor {
 					text = cursor_style.Render(text)
 				}
@@ -629,7 +1049,17 @@ func (model model) View() string {
 
 		lines = append(lines, " ")
 
-		return slice.Join(lines[model.scroll:min(model.scroll+model.height, len(lines))], "\n")
+		footer := model.footerView()
+		height := model.height
+		if len(footer) > 0 {
+			height -= lipgloss.Height(footer)
+		}
+
+		view := slice.Join(lines[model.scroll:max(min(model.scroll+height, len(lines)), model.scroll)], "\n")
+		if len(footer) > 0 {
+			view += "\n" + footer
+		}
+		return view
 	}
 }
 
@@ -637,26 +1067,60 @@ type directory struct {
 	path string
 	stat *status
 	dif  []diff
+	// Set when the status couldn't be read, in which case `stat` is nil
+	err error
+	// Set while the status is read in the background
+	loading bool
+	// Counts the reads of the status, so only the last one is shown
+	loadGeneration int
+	// The diff is only read once a file is opened
+	difLoaded  bool
+	difLoading bool
+	// Counts the changes to the repository, so diffs read before the last one
+	// can be told apart
+	difGeneration int
+	// The push, pull or fetch running in the background, if any
+	operation *remoteOperation
+	stashes   []stashEntry
+	// The diffs of the opened stashes by their ref, read in the background
+	stashDiffs map[string]*stashDiff
+}
+
+func (dir *directory) loadStatus() error {
+	dir.stat, dir.stashes, dir.err = readDirectory(dir.path)
+	return dir.err
 }
 
-func Interactive() {
+// Starts the interactive view. When watching, repositories are refreshed as
+// soon as their working tree or index changes.
+func Interactive(watch bool, options DiffOptions) {
 	paths := getDirectories(false)
+	if getConfigBool("submodules.recurse") {
+		paths = withSubmodules(paths)
+	}
 
-	dirs := slice.ParallelMap(
-		paths,
-		func(path string, _ int) *directory {
-			stat, _ := getStatus(path)
-			dif, _ := getDiff(path)
-			return &directory{
-				path: path,
-				stat: stat,
-				dif:  dif,
-			}
-		},
-	)
+	// Push, pull and fetch run in the background, so git can't prompt for
+	// credentials without breaking the view. Fail instead.
+	os.Setenv("GIT_TERMINAL_PROMPT", "0")
+
+	dirs := slice.Map(paths, func(path string, _ int) *directory {
+		return &directory{path: path, loading: true}
+	})
+
+	m := initialModel(dirs)
+	m.diffOptions = options
+	if watch || getConfigBool("interactive.watch") {
+		w, err := newWatcher(paths)
+		if err != nil {
+			log.Errorf("Failed to start the file watcher: %v\n", err)
+		} else {
+			defer w.Close()
+			m.watcher = w
+		}
+	}
 
 	p := tea.NewProgram(
-		initialModel(dirs),
+		m,
 		tea.WithAltScreen(),
 		tea.WithMouseCellMotion(),
 	)
@@ -0,0 +1,308 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Otard95/ngm/lib/slice"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type branchPanelMode int
+
+const (
+	BRANCH_BROWSE branchPanelMode = iota
+	BRANCH_CREATE
+	BRANCH_RENAME
+	BRANCH_DELETE
+	BRANCH_FORCE_DELETE
+)
+
+// A branch as it exists across the repositories of the panel. Rows without a
+// name are section headers.
+type branchRow struct {
+	header   string
+	name     string
+	remote   bool
+	branches map[*directory]branchInfo
+}
+
+// Lists the branches of one or more repositories and lets the user act on
+// them. With several repositories, actions apply to every repository having
+// the branch.
+type branchPanel struct {
+	dirs   []*directory
+	rows   []branchRow
+	cursor int
+	mode   branchPanelMode
+	input  textinput.Model
+}
+
+func newBranchPanel(dirs []*directory) (branchPanel, error) {
+	input := textinput.New()
+	input.Prompt = "> "
+
+	panel := branchPanel{dirs: dirs, input: input}
+	return panel, panel.load()
+}
+
+func (panel *branchPanel) load() error {
+	type result struct {
+		branches []branchInfo
+		err      error
+	}
+	results := slice.ParallelMap(panel.dirs, func(dir *directory, _ int) result {
+		branches, err := getBranches(dir.path)
+		return result{branches, err}
+	})
+
+	local := []branchRow{}
+	remote := []branchRow{}
+	errs := []error{}
+	for i, dir := range panel.dirs {
+		if results[i].err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", dir.path, results[i].err))
+			continue
+		}
+		for _, branch := range results[i].branches {
+			rows := &local
+			if branch.remote {
+				rows = &remote
+			}
+			j := slices.IndexFunc(*rows, func(r branchRow) bool { return r.name == branch.name })
+			if j == -1 {
+				*rows = append(*rows, branchRow{name: branch.name, remote: branch.remote, branches: map[*directory]branchInfo{}})
+				j = len(*rows) - 1
+			}
+			(*rows)[j].branches[dir] = branch
+		}
+	}
+
+	panel.rows = slices.Concat(
+		[]branchRow{{header: "Local"}},
+		local,
+		[]branchRow{{header: " "}, {header: "Remote"}},
+		remote,
+	)
+	panel.cursor = min(max(panel.cursor, 1), len(panel.rows)-1)
+	if panel.rows[panel.cursor].header != "" {
+		panel.move(1)
+	}
+	return errors.Join(errs...)
+}
+
+// Moves the cursor, skipping the section headers.
+func (panel *branchPanel) move(delta int) {
+	for i := panel.cursor + delta; i >= 0 && i < len(panel.rows); i += delta {
+		if len(panel.rows[i].header) == 0 {
+			panel.cursor = i
+			return
+		}
+	}
+}
+
+func (panel *branchPanel) selected() *branchRow {
+	if panel.cursor >= len(panel.rows) || len(panel.rows[panel.cursor].header) > 0 {
+		return nil
+	}
+	return &panel.rows[panel.cursor]
+}
+
+func (panel *branchPanel) startInput(mode branchPanelMode, value string) {
+	panel.mode = mode
+	panel.input.SetValue(value)
+	panel.input.CursorEnd()
+	panel.input.Focus()
+}
+
+func (panel *branchPanel) endInput() {
+	panel.mode = BRANCH_BROWSE
+	panel.input.Blur()
+	panel.input.SetValue("")
+}
+
+func (row branchRow) String(dirs []*directory) string {
+	current := slice.Filter(dirs, func(dir *directory, _ int) bool {
+		branch, ok := row.branches[dir]
+		return ok && branch.current
+	})
+
+	marker := "  "
+	if len(current) > 0 && len(current) == len(row.branches) {
+		marker = "* "
+	} else if len(current) > 0 {
+		marker = "~ "
+	}
+
+	if len(dirs) == 1 {
+		return marker + row.name + "  " + help_desc_style.Render(row.branches[dirs[0]].Tracking())
+	}
+	return marker + row.name + "  " + help_desc_style.Render(fmt.Sprintf("(%d/%d)", len(row.branches), len(dirs)))
+}
+
+func (panel branchPanel) View(km keymap, height int) string {
+	title := "Branches in " + panel.dirs[0].path
+	if len(panel.dirs) > 1 {
+		title = fmt.Sprintf("Branches in %d repositories", len(panel.dirs))
+	}
+
+	lines := slice.Map(panel.rows, func(row branchRow, i int) string {
+		if len(row.header) > 0 {
+			return row.header
+		}
+		text := "  " + row.String(panel.dirs)
+		if i == panel.cursor {
+			text = cursor_style.Render(text)
+		}
+		return text
+	})
+	if height > 0 && len(lines) > height {
+		start := min(max(panel.cursor-height/2, 0), len(lines)-height)
+		lines = lines[start : start+height]
+	}
+
+	footer := fmt.Sprintf(
+		"%s checkout, %s new branch, %s rename, %s delete, %s force delete, Esc close",
+		km.choose.Help().Key, km.newBranch.Help().Key, km.renameBranch.Help().Key,
+		km.deleteBranch.Help().Key, km.forceDeleteBranch.Help().Key,
+	)
+	switch panel.mode {
+	case BRANCH_CREATE:
+		footer = "New branch from HEAD (Enter to create, Esc to cancel)\n" + panel.input.View()
+	case BRANCH_RENAME:
+		footer = "Rename branch (Enter to rename, Esc to cancel)\n" + panel.input.View()
+	case BRANCH_DELETE, BRANCH_FORCE_DELETE:
+		footer = fmt.Sprintf("Delete %s? (y/n)", panel.selected().name)
+	}
+
+	return " " + title + "\n\n" + slice.Join(lines, "\n") + "\n\n" + footer
+}
+
+func (model *model) openBranches(dirs []*directory) {
+	dirs = slice.Filter(dirs, func(dir *directory, _ int) bool { return dir != nil && dir.stat != nil })
+	if len(dirs) == 0 {
+		return
+	}
+
+	panel, err := newBranchPanel(dirs)
+	if err != nil {
+		model.notifyError(err)
+	}
+	model.branches = panel
+	model.branching = true
+}
+
+// Runs the action in each of the panel's repositories that has the branch,
+// then reloads the branches and the status of the repositories.
+func (model *model) branchAction(row *branchRow, action func(dir *directory, branch branchInfo) error) tea.Cmd {
+	dirs := slice.Filter(model.branches.dirs, func(dir *directory, _ int) bool {
+		_, ok := row.branches[dir]
+		return ok
+	})
+	errs := slice.ParallelMap(dirs, func(dir *directory, _ int) error {
+		if err := action(dir, row.branches[dir]); err != nil {
+			return fmt.Errorf("%s: %w", dir.path, err)
+		}
+		return nil
+	})
+	return model.branchesChanged(dirs, errs)
+}
+
+func (model *model) branchesChanged(dirs []*directory, errs []error) tea.Cmd {
+	if err := errors.Join(errs...); err != nil {
+		model.notifyError(err)
+	}
+	if err := model.branches.load(); err != nil {
+		model.notifyError(err)
+	}
+	return tea.Batch(slice.Map(dirs, func(dir *directory, _ int) tea.Cmd {
+		return model.refresh(dir.path)
+	})...)
+}
+
+func (model *model) updateBranches(msg tea.KeyMsg) tea.Cmd {
+	panel := &model.branches
+	row := panel.selected()
+	model.notification = nil
+
+	switch panel.mode {
+	case BRANCH_CREATE, BRANCH_RENAME:
+		switch msg.String() {
+		case "esc":
+			panel.endInput()
+		case "enter":
+			name := strings.TrimSpace(panel.input.Value())
+			mode := panel.mode
+			panel.endInput()
+			if len(name) == 0 {
+				return nil
+			}
+			if mode == BRANCH_CREATE {
+				errs := slice.ParallelMap(panel.dirs, func(dir *directory, _ int) error {
+					if err := doCreateBranch(dir.path, name); err != nil {
+						return fmt.Errorf("%s: %w", dir.path, err)
+					}
+					return nil
+				})
+				return model.branchesChanged(panel.dirs, errs)
+			}
+			return model.branchAction(row, func(dir *directory, branch branchInfo) error {
+				return doRenameBranch(dir.path, branch.name, name)
+			})
+		default:
+			var cmd tea.Cmd
+			panel.input, cmd = panel.input.Update(msg)
+			return cmd
+		}
+		return nil
+
+	case BRANCH_DELETE, BRANCH_FORCE_DELETE:
+		force := panel.mode == BRANCH_FORCE_DELETE
+		panel.mode = BRANCH_BROWSE
+		if msg.String() != "y" || row == nil {
+			return nil
+		}
+		return model.branchAction(row, func(dir *directory, branch branchInfo) error {
+			return doDeleteBranch(dir.path, branch.name, force)
+		})
+	}
+
+	km := model.keymap
+	switch {
+	case msg.String() == "esc" || msg.String() == "q":
+		model.branching = false
+	case key.Matches(msg, km.up):
+		panel.move(-1)
+	case key.Matches(msg, km.down):
+		panel.move(1)
+	case key.Matches(msg, km.choose):
+		if row != nil {
+			return model.branchAction(row, func(dir *directory, branch branchInfo) error {
+				return doSwitchBranch(dir.path, branch)
+			})
+		}
+	case key.Matches(msg, km.newBranch):
+		panel.startInput(BRANCH_CREATE, "")
+	case key.Matches(msg, km.renameBranch):
+		if row != nil && !row.remote {
+			panel.startInput(BRANCH_RENAME, row.name)
+		}
+	case key.Matches(msg, km.deleteBranch, km.forceDeleteBranch):
+		if row == nil {
+			return nil
+		}
+		if row.remote {
+			model.notifyError(errors.New("Deleting remote branches isn't supported"))
+			return nil
+		}
+		panel.mode = BRANCH_DELETE
+		if key.Matches(msg, km.forceDeleteBranch) {
+			panel.mode = BRANCH_FORCE_DELETE
+		}
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Otard95/ngm/lib/slice"
+	"github.com/Otard95/ngm/ui"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	option_on_style  = lipgloss.NewStyle().Foreground(ui.ColorGreen)
+	option_off_style = lipgloss.NewStyle().Foreground(ui.ColorOverlay0)
+)
+
+type commitResult struct {
+	text string
+	path string
+	ok   bool
+}
+
+func commitOutput(results []commitResult) string {
+	return slice.Join(slice.Map(
+		results,
+		func(res commitResult, _ int) string {
+			out := ""
+			if res.ok {
+				out = "[OK]"
+			} else {
+				out = "[ERROR]"
+			}
+
+			out += res.path + "\n" + res.text + "\n\n"
+			return out
+		},
+	), "\n")
+}
+
+// The repositories with staged changes. When anything is selected, only the
+// selected repositories are included.
+func (model *model) stagedDirectories() []*directory {
+	dirs := model.directories
+	if len(model.selection) > 0 {
+		dirs = model.selectedDirectories()
+	}
+	return slice.Filter(dirs, func(dir *directory, _ int) bool {
+		return dir.stat != nil && len(dir.stat.staged) > 0
+	})
+}
+
+// The repositories a commit applies to. This is every repository with staged
+// changes, or when amending without anything staged, the repository under the
+// cursor so the last commit can be reworded.
+func (model *model) commitDirectories() []*directory {
+	dirs := model.stagedDirectories()
+	if len(dirs) == 0 && model.commitOptions.amend && len(model.lines) > 0 {
+		if dir := lineDirectory(model.lines[model.cursor]); dir != nil {
+			return []*directory{dir}
+		}
+	}
+	return dirs
+}
+
+// Commits with the message to every repository the commit applies to. When
+// amending with the message that was loaded, each commit keeps its own message
+// instead, since the message is only that of the first repository.
+func (model *model) commit(message string) []commitResult {
+	options := model.commitOptions
+	if options.amend && cleanupMessage(message) == cleanupMessage(model.amendMessage) {
+		options.keepMessage = true
+	}
+	return slice.ParallelMap(
+		model.commitDirectories(),
+		func(dir *directory, _ int) commitResult {
+			result, err := doCommit(dir.path, message, options)
+			return commitResult{
+				text: result,
+				path: dir.path,
+				ok:   err == nil,
+			}
+		},
+	)
+}
+
+// Commits to all repositories with staged changes and shows the result in
+// place of the commit message.
+func (model *model) finishCommit(message string) {
+	model.showCommitOutput(commitOutput(model.commit(message)))
+}
+
+func (model *model) startCommit() {
+	model.committing = true
+	template := cleanupMessage(getCommitTemplates(model.stagedDirectories()))
+	model.template = template
+
+	if model.conventional {
+		model.commitForm = newCommitForm(model.commitTypes, template)
+		model.commitForm.SetWidth(model.width)
+	} else {
+		if len(model.textInput.Value()) == 0 {
+			model.textInput.SetValue(template)
+		}
+		model.textInput.Focus()
+	}
+
+	if model.commitOptions.amend {
+		model.loadAmendMessage()
+	}
+}
+
+func (model *model) submitCommit() {
+	if !model.conventional {
+		if model.unchangedTemplate(model.textInput.Value()) {
+			model.notifyError(errors.New(unchangedTemplateError))
+			return
+		}
+		model.finishCommit(model.textInput.Value())
+		return
+	}
+
+	message, err := model.commitForm.Message()
+	if err != nil {
+		model.commitForm.SetError(err)
+		return
+	}
+	model.finishCommit(message)
+}
+
+// Leaves the commit screen. Neither the options nor the message carry over to
+// the next commit, so it doesn't amend with a message loaded for an amend that
+// was cancelled.
+func (model *model) cancelCommit() {
+	model.committing = false
+	model.commitOptions = commitOptions{}
+	model.amendMessage = ""
+	model.template = ""
+	model.textInput.Reset()
+	model.textInput.Blur()
+}
+
+const unchangedTemplateError = "Aborting commit; you did not edit the message."
+
+// Whether the message is the commit template as it was filled in, which git
+// doesn't commit either. Amending doesn't start from the template.
+func (model *model) unchangedTemplate(message string) bool {
+	return !model.commitOptions.amend &&
+		len(model.template) > 0 &&
+		cleanupMessage(message) == model.template
+}
+
+func (model *model) validateMessage(message string) error {
+	if model.conventional {
+		return validateConventionalCommit(message, model.commitTypes)
+	}
+	return nil
+}
+
+func (model *model) showCommitOutput(text string) {
+	model.textInput.SetValue(text)
+	model.textInput.Blur()
+	model.committing = false
+	model.fixingUp = false
+	model.afterCommit = true
+}
+
+// Toggles the commit options from within the commit screen. Returns false if
+// the key isn't bound to an option, in which case it should be passed on to
+// the message input.
+func (model *model) toggleCommitOption(msg tea.KeyMsg) bool {
+	switch {
+	case key.Matches(msg, model.keymap.toggleAmend):
+		model.commitOptions.amend = !model.commitOptions.amend
+		if model.commitOptions.amend {
+			model.loadAmendMessage()
+		}
+	case key.Matches(msg, model.keymap.toggleSignoff):
+		model.commitOptions.signoff = !model.commitOptions.signoff
+	case key.Matches(msg, model.keymap.toggleGpgSign):
+		model.commitOptions.gpgSign = !model.commitOptions.gpgSign
+	case key.Matches(msg, model.keymap.toggleNoVerify):
+		model.commitOptions.noVerify = !model.commitOptions.noVerify
+	default:
+		return false
+	}
+	return true
+}
+
+// Replaces the message with the message of the commit being amended. When
+// amending in several repositories the message of the first one is shown, and
+// only used if it's changed.
+func (model *model) loadAmendMessage() {
+	dirs := model.commitDirectories()
+	if len(dirs) == 0 {
+		return
+	}
+	message, err := getLastCommitMessage(dirs[0].path)
+	if err != nil {
+		return
+	}
+	model.amendMessage = message
+
+	if model.conventional {
+		model.commitForm.SetCommit(parseConventionalCommit(message))
+	} else {
+		model.textInput.SetValue(message)
+	}
+}
+
+func (model *model) commitOptionsView() string {
+	option := func(enabled bool, binding key.Binding) string {
+		text := binding.Help().Desc + " (" + binding.Help().Key + ")"
+		if enabled {
+			return option_on_style.Render("[x] " + text)
+		}
+		return option_off_style.Render("[ ] " + text)
+	}
+	return " " + slice.Join([]string{
+		option(model.commitOptions.amend, model.keymap.toggleAmend),
+		option(model.commitOptions.signoff, model.keymap.toggleSignoff),
+		option(model.commitOptions.gpgSign, model.keymap.toggleGpgSign),
+		option(model.commitOptions.noVerify, model.keymap.toggleNoVerify),
+	}, "  ")
+}
+
+func (model *model) startFixup() {
+	dirs := model.stagedDirectories()
+	if len(dirs) == 0 {
+		model.showCommitOutput("Nothing staged to commit")
+		return
+	}
+	model.fixup = newFixupPicker(dirs)
+	model.fixingUp = true
+}
+
+func (model *model) cancelFixup() {
+	model.fixingUp = false
+	model.fixup = fixupPicker{}
+	model.commitOptions = commitOptions{}
+}
+
+// Creates a `--fixup` commit in each repository a target commit was selected
+// for.
+func (model *model) commitFixups() {
+	dirs := slice.Filter(model.stagedDirectories(), func(dir *directory, _ int) bool {
+		_, ok := model.fixup.targets[dir]
+		return ok
+	})
+	if len(dirs) == 0 {
+		model.notifyError(errors.New("Select the commit to fix up in at least one repository"))
+		return
+	}
+
+	results := slice.ParallelMap(dirs, func(dir *directory, _ int) commitResult {
+		options := model.commitOptions
+		options.amend = false
+		options.fixup = model.fixup.targets[dir]
+		result, err := doCommit(dir.path, "", options)
+		return commitResult{
+			text: result,
+			path: dir.path,
+			ok:   err == nil,
+		}
+	})
+	model.showCommitOutput(commitOutput(results))
+}
+
+type editorFinishedMsg struct {
+	file string
+	err  error
+}
+
+// Opens the users editor with a commit template listing the repositories and
+// staged files. The commit happens when the resulting `editorFinishedMsg` is
+// received.
+func (model *model) commitWithEditor() tea.Cmd {
+	dirs := model.commitDirectories()
+	if len(dirs) == 0 {
+		model.showCommitOutput("Nothing staged to commit")
+		return nil
+	}
+
+	message := ""
+	if model.commitOptions.amend {
+		message, _ = getLastCommitMessage(dirs[0].path)
+		model.amendMessage = message
+	} else {
+		model.template = cleanupMessage(getCommitTemplates(dirs))
+	}
+
+	file, err := writeCommitTemplate(dirs, message)
+	if err != nil {
+		model.showCommitOutput(fmt.Sprintf("Failed to write commit template: %v", err))
+		return nil
+	}
+
+	return tea.ExecProcess(editorCommand(file), func(err error) tea.Msg {
+		return editorFinishedMsg{file: file, err: err}
+	})
+}
+
+func (model *model) editorFinished(msg editorFinishedMsg) {
+	if msg.err != nil {
+		model.showCommitOutput(fmt.Sprintf("Editor exited with an error: %v", msg.err))
+		return
+	}
+
+	message, err := readCommitMessage(msg.file)
+	if err != nil {
+		model.showCommitOutput(fmt.Sprintf("Failed to read commit message: %v", err))
+		return
+	}
+	if len(message) == 0 {
+		model.showCommitOutput("Aborting commit due to empty commit message.")
+		return
+	}
+	if model.unchangedTemplate(message) {
+		model.showCommitOutput(unchangedTemplateError)
+		return
+	}
+	if err := model.validateMessage(message); err != nil {
+		model.showCommitOutput(fmt.Sprintf("Invalid commit message: %v\n\n%s", err, message))
+		return
+	}
+
+	model.finishCommit(message)
+}
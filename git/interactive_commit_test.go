@@ -0,0 +1,121 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+// Creates a repository with one commit and a staged change.
+func commitTestRepository(t *testing.T) string {
+	dir := t.TempDir()
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	git := func(args ...string) {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	os.WriteFile(filepath.Join(dir, "file.txt"), []byte("a\n"), 0644)
+	git("add", "file.txt")
+	git("commit", "-q", "-m", "old message")
+	os.WriteFile(filepath.Join(dir, "file.txt"), []byte("b\n"), 0644)
+	git("add", "file.txt")
+	return dir
+}
+
+func pressKey(m tea.Model, k tea.KeyMsg) tea.Model {
+	m, _ = m.Update(k)
+	return m
+}
+
+func TestCancelThenCommit(t *testing.T) {
+	dir := &directory{path: commitTestRepository(t)}
+	assert.NoError(t, dir.loadStatus())
+
+	var m tea.Model = initialModel([]*directory{dir})
+	m = pressKey(m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("A")})
+	m = pressKey(m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("s"), Alt: true})
+	assert.True(t, m.(model).commitOptions.amend)
+	assert.Equal(t, "old message", m.(model).textInput.Value())
+
+	m = pressKey(m, tea.KeyMsg{Type: tea.KeyEsc})
+	m = pressKey(m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("c")})
+	assert.True(t, m.(model).committing)
+	assert.Equal(t, commitOptions{}, m.(model).commitOptions)
+	assert.NotEqual(t, "old message", m.(model).textInput.Value())
+}
+
+func TestAmendKeepsTheMessageOfEachRepository(t *testing.T) {
+	first, second := commitTestRepository(t), commitTestRepository(t)
+	assert.NoError(t, exec.Command("git", "-C", second, "commit", "-q", "--amend", "--only", "-m", "second message").Run())
+	dirs := []*directory{{path: first}, {path: second}}
+	for _, dir := range dirs {
+		assert.NoError(t, dir.loadStatus())
+	}
+
+	var m tea.Model = initialModel(dirs)
+	m = pressKey(m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("A")})
+	assert.Equal(t, "old message", m.(model).textInput.Value())
+	m = pressKey(m, tea.KeyMsg{Type: tea.KeyCtrlC})
+
+	for dir, expected := range map[string]string{first: "old message", second: "second message"} {
+		message, err := getLastCommitMessage(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, message)
+	}
+}
+
+func TestCommitFixupsWithoutTarget(t *testing.T) {
+	dir := &directory{path: commitTestRepository(t)}
+	assert.NoError(t, dir.loadStatus())
+
+	var m tea.Model = initialModel([]*directory{dir})
+	m = pressKey(m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("F")})
+	m = pressKey(m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("c")})
+	assert.True(t, m.(model).fixingUp)
+	assert.NotNil(t, m.(model).notification)
+}
+
+func TestUnchangedTemplateIsNotCommitted(t *testing.T) {
+	dir := &directory{path: commitTestRepository(t)}
+	template := filepath.Join(dir.path, ".gitmessage")
+	os.WriteFile(template, []byte("Summary\n\n# Explain why\n"), 0644)
+	assert.NoError(t, exec.Command("git", "-C", dir.path, "config", "commit.template", template).Run())
+	assert.NoError(t, dir.loadStatus())
+
+	var m tea.Model = initialModel([]*directory{dir})
+	m = pressKey(m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("c")})
+	assert.Equal(t, "Summary", m.(model).textInput.Value())
+	m = pressKey(m, tea.KeyMsg{Type: tea.KeyCtrlC})
+	assert.True(t, m.(model).committing)
+	assert.NotNil(t, m.(model).notification)
+
+	m = pressKey(m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("!")})
+	m = pressKey(m, tea.KeyMsg{Type: tea.KeyCtrlC})
+	message, err := getLastCommitMessage(dir.path)
+	assert.NoError(t, err)
+	assert.Equal(t, "Summary!", message)
+}
+
+func TestUnchangedTemplateIsLeftOutOfTheBody(t *testing.T) {
+	form := newCommitForm([]string{"feat"}, "Explain why")
+	form.subject.SetValue("add it")
+	message, err := form.Message()
+	assert.NoError(t, err)
+	assert.Equal(t, "feat: add it", message)
+
+	form.body.SetValue("Because")
+	message, err = form.Message()
+	assert.NoError(t, err)
+	assert.Equal(t, "feat: add it\n\nBecause", message)
+}
@@ -0,0 +1,114 @@
+package git
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/Otard95/ngm/lib/slice"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type unmergedLine struct {
+	dir    *directory
+	change unmergedChange
+	toggle
+	childLine
+}
+
+func (unmergedLine) isLine() {}
+func (u unmergedLine) Render() string {
+	return unstaged_style.Render("  " + u.change.String())
+}
+func (u unmergedLine) Key() string {
+	return "unmerged:" + u.change.file
+}
+
+// The conflicting regions of the file, ours in red and theirs in green like a
+// diff from our version to theirs.
+func conflictLines(u *unmergedLine) []line {
+	text := func(s string) line {
+		return &textLine{text: s, childLine: childLine{parent: u}}
+	}
+
+	conflicts, err := getConflicts(u.dir.path, u.change.file)
+	if err != nil {
+		return []line{text("   " + err.Error())}
+	}
+	if len(conflicts) == 0 {
+		return []line{text("   No conflict markers")}
+	}
+
+	lines := []line{}
+	for _, c := range conflicts {
+		lines = append(lines, text(diffHeader.Render("<<<<<<< "+c.oursLabel)))
+		lines = append(lines, slice.Map(c.ours, func(l string, _ int) line { return text(diffRemove.Render(l)) })...)
+		if len(c.base) > 0 {
+			lines = append(lines, text(diffHeader.Render("|||||||")))
+			lines = append(lines, slice.Map(c.base, func(l string, _ int) line { return text(diffUnchanged.Render(l)) })...)
+		}
+		lines = append(lines, text(diffHeader.Render("=======")))
+		lines = append(lines, slice.Map(c.theirs, func(l string, _ int) line { return text(diffAdd.Render(l)) })...)
+		lines = append(lines, text(diffHeader.Render(">>>>>>> "+c.theirsLabel)))
+	}
+	return lines
+}
+
+// Asks to resolve the conflict under the cursor by taking one side, since the
+// changes of the other side are lost.
+func (model *model) resolveConflict(side conflictSide) {
+	if len(model.lines) == 0 {
+		return
+	}
+	unmerged, ok := model.lines[model.cursor].(*unmergedLine)
+	if !ok {
+		return
+	}
+
+	action := "Take " + side.String() + " for"
+	if !unmerged.change.Has(side) {
+		action = "Delete"
+	}
+	model.confirm(
+		fmt.Sprintf("%s %s in %s?", action, unmerged.change.file, unmerged.dir.path),
+		[]*directory{unmerged.dir},
+		func() error {
+			if err := doResolveConflict(unmerged.dir.path, unmerged.change, side); err != nil {
+				return fmt.Errorf("Failed to resolve %s: %w", unmerged.change.file, err)
+			}
+			return nil
+		},
+	)
+}
+
+type conflictEditedMsg struct {
+	path string
+	err  error
+}
+
+// Opens the file under the cursor in the users editor, or in the merge tool,
+// refreshing the repository once it's closed.
+func (model *model) editConflict(mergetool bool) tea.Cmd {
+	if len(model.lines) == 0 {
+		return nil
+	}
+	unmerged, ok := model.lines[model.cursor].(*unmergedLine)
+	if !ok {
+		return nil
+	}
+
+	dir := unmerged.dir.path
+	cmd := editorCommand(path.Join(dir, unmerged.change.file))
+	if mergetool {
+		cmd = mergetoolCommand(dir, unmerged.change.file)
+	}
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		return conflictEditedMsg{path: dir, err: err}
+	})
+}
+
+func (model *model) conflictEdited(msg conflictEditedMsg) tea.Cmd {
+	if msg.err != nil {
+		model.notifyError(fmt.Errorf("Failed to edit the conflict in %s: %w", msg.path, msg.err))
+	}
+	return model.refresh(msg.path)
+}
@@ -0,0 +1,176 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Otard95/ngm/lib/slice"
+	"github.com/Otard95/ngm/ui"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const logCommitCount = 100
+
+var (
+	log_hash_style   = lipgloss.NewStyle().Foreground(ui.ColorYellow)
+	log_author_style = lipgloss.NewStyle().Foreground(ui.ColorBlue)
+	log_refs_style   = lipgloss.NewStyle().Foreground(ui.ColorPeach)
+	log_repo_style   = lipgloss.NewStyle().Foreground(ui.ColorMauve)
+)
+
+type commitLine struct {
+	dir   *directory
+	entry logEntry
+	// Prefix the line with the repository when several are listed together
+	showDir bool
+	toggle
+}
+
+func (commitLine) isLine() {}
+func (c commitLine) Render() string {
+	text := log_hash_style.Render(c.entry.hash) + " " +
+		help_desc_style.Render(c.entry.date.Format("2006-01-02 15:04")) + " " +
+		log_author_style.Render(c.entry.author) + " " +
+		c.entry.subject
+	if len(c.entry.refs) > 0 {
+		text += " " + log_refs_style.Render("("+slice.Join(c.entry.refs, ", ")+")")
+	}
+	if c.showDir {
+		text = log_repo_style.Render(c.dir.path) + " " + text
+	}
+	return text
+}
+
+// The files changed by the commit, each followed by its diff.
+func commitChildren(c *commitLine, options DiffOptions) []line {
+	difs, err := getCommitDiff(c.dir.path, c.entry.hash)
+	return changeLines(c, c.dir, difs, err, options)
+}
+
+// Lists the recent commits of a repository, or of several repositories
+// interleaved by date, with the diff of each commit shown when it's opened.
+type logPane struct {
+	dirs    []*directory
+	lines   []line
+	cursor  int
+	options DiffOptions
+}
+
+func newLogPane(dirs []*directory, options DiffOptions) (logPane, error) {
+	type result struct {
+		entries []logEntry
+		err     error
+	}
+	results := slice.ParallelMap(dirs, func(dir *directory, _ int) result {
+		entries, err := getLog(dir.path, logCommitCount)
+		return result{entries, err}
+	})
+
+	commits := []*commitLine{}
+	errs := []error{}
+	for i, dir := range dirs {
+		if results[i].err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", dir.path, results[i].err))
+			continue
+		}
+		for _, entry := range results[i].entries {
+			commits = append(commits, &commitLine{dir: dir, entry: entry, showDir: len(dirs) > 1})
+		}
+	}
+	slices.SortStableFunc(commits, func(a, b *commitLine) int {
+		return b.entry.date.Compare(a.entry.date)
+	})
+
+	pane := logPane{
+		dirs:    dirs,
+		lines:   slice.Map(commits, func(c *commitLine, _ int) line { return c }),
+		options: options,
+	}
+	return pane, errors.Join(errs...)
+}
+
+func (pane *logPane) move(delta int) {
+	pane.cursor = max(min(pane.cursor+delta, len(pane.lines)-1), 0)
+}
+
+// Opens or closes the commit under the cursor. On a line of the diff, the
+// commit it belongs to is closed.
+func (pane *logPane) toggle() {
+	if len(pane.lines) == 0 {
+		return
+	}
+	if parented_line, ok := pane.lines[pane.cursor].(parented); ok {
+		pane.cursor = max(slices.Index(pane.lines, parented_line.Parent()), 0)
+	}
+	commit, ok := pane.lines[pane.cursor].(*commitLine)
+	if !ok {
+		return
+	}
+
+	if commit.Open() {
+		pane.lines = slices.DeleteFunc(pane.lines, func(l line) bool {
+			parented_line, ok := l.(parented)
+			return ok && parented_line.Parent() == commit
+		})
+		commit.SetOpen(false)
+		return
+	}
+	commit.SetOpen(true)
+	pane.lines = slices.Insert(pane.lines, pane.cursor+1, commitChildren(commit, pane.options)...)
+}
+
+func (pane *logPane) Update(km keymap, msg tea.KeyMsg) {
+	switch {
+	case key.Matches(msg, km.up):
+		pane.move(-1)
+	case key.Matches(msg, km.down):
+		pane.move(1)
+	case key.Matches(msg, km.toggle, km.choose):
+		pane.toggle()
+	}
+}
+
+func (pane logPane) View(width, height int) string {
+	title := "Log of " + pane.dirs[0].path
+	if len(pane.dirs) > 1 {
+		title = fmt.Sprintf("Log of %d repositories", len(pane.dirs))
+	}
+
+	lines := slice.Map(pane.lines, func(l line, i int) string {
+		text, _ := renderLine(l, width)
+		if i == pane.cursor {
+			text = cursor_style.Render(text)
+		}
+		return text
+	})
+	if len(lines) == 0 {
+		lines = []string{"No commits"}
+	}
+	if height > 0 && len(lines) > height {
+		start := min(max(pane.cursor-height/2, 0), len(lines)-height)
+		lines = lines[start : start+height]
+	}
+
+	return " " + title + "\n\n" + slice.Join(lines, "\n") +
+		"\n\nSpace/Tab to show the changes of the commit, Esc to close"
+}
+
+func (model *model) openLog(dirs []*directory) {
+	// Repositories without any commits yet have no log to show
+	dirs = slice.Filter(dirs, func(dir *directory, _ int) bool {
+		return dir != nil && dir.stat != nil && dir.stat.branch.commit != "(initial)"
+	})
+	if len(dirs) == 0 {
+		return
+	}
+
+	pane, err := newLogPane(dirs, model.diffOptions)
+	if err != nil {
+		model.notifyError(err)
+	}
+	model.log = pane
+	model.viewingLog = true
+}
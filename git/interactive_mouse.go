@@ -0,0 +1,139 @@
+package git
+
+import (
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Two clicks on the same line within this interval is a double click.
+const doubleClickInterval = 400 * time.Millisecond
+
+// Lines scrolled by each step of the mouse wheel.
+const wheelStep = 3
+
+// A click waiting to see if it becomes a double click.
+type pendingClick struct {
+	id   int
+	line int
+	// Set when the line was under the cursor already, in which case it's
+	// toggled once it's clear it's not a double click
+	toggle bool
+}
+
+type clickTimeoutMsg struct {
+	id int
+}
+
+// The index of the line at row y of the view, or -1 if there is no line there.
+// The rows are laid out like View does, where the help at the top takes three
+// rows and lines may take several, e.g. when wrapped.
+func (model *model) lineAt(y int) int {
+	width := model.width
+	if len(model.selection) > 0 {
+		width--
+	}
+	entries := [][]int{{-1, -1, -1}}
+	for i, l := range model.lines {
+		if text, ok := renderLine(l, width); ok {
+			entries = append(entries, slices.Repeat([]int{i}, lipgloss.Height(text)))
+		}
+	}
+	entries = append(entries, []int{-1})
+
+	height := model.height
+	if footer := model.footerView(); len(footer) > 0 {
+		height -= lipgloss.Height(footer)
+	}
+	start := min(model.scroll, len(entries))
+	rows := slices.Concat(entries[start:max(min(start+height, len(entries)), start)]...)
+	if y < 0 || y >= len(rows) {
+		return -1
+	}
+	return rows[y]
+}
+
+func (model *model) mouse(msg tea.MouseMsg) tea.Cmd {
+	if msg.Action != tea.MouseActionPress {
+		return nil
+	}
+
+	switch msg.Button {
+	case tea.MouseButtonWheelUp:
+		model.wheel(-wheelStep)
+	case tea.MouseButtonWheelDown:
+		model.wheel(wheelStep)
+	case tea.MouseButtonLeft:
+		return model.click(model.lineAt(msg.Y))
+	}
+	return nil
+}
+
+// Scrolls the view, dragging the cursor along when it would leave it.
+func (model *model) wheel(delta int) {
+	// The help and the blank line at the end are part of the view too
+	model.scroll = max(min(model.scroll+delta, len(model.lines)+2-model.height), 0)
+	if len(model.lines) == 0 {
+		return
+	}
+	if model.scroll > 0 && model.cursor < model.scroll+5 {
+		model.cursor = min(model.scroll+5, len(model.lines)-1)
+	}
+	if model.cursor > model.scroll+model.height-5 {
+		model.cursor = max(model.scroll+model.height-5, 0)
+	}
+}
+
+// Moves the cursor to the clicked line. Clicking the line under the cursor
+// toggles it, and double clicking stages or unstages it.
+func (model *model) click(index int) tea.Cmd {
+	if index < 0 {
+		return nil
+	}
+	model.notification = nil
+
+	if model.pendingClick != nil && model.pendingClick.line == index {
+		model.pendingClick = nil
+		model.cursor = index
+		return model.doubleClick()
+	}
+
+	model.clicks++
+	model.pendingClick = &pendingClick{id: model.clicks, line: index, toggle: index == model.cursor}
+	model.cursor = index
+	id := model.clicks
+	return tea.Tick(doubleClickInterval, func(time.Time) tea.Msg {
+		return clickTimeoutMsg{id: id}
+	})
+}
+
+func (model *model) clickTimeout(msg clickTimeoutMsg) tea.Cmd {
+	if model.pendingClick == nil || model.pendingClick.id != msg.id {
+		return nil
+	}
+	click := model.pendingClick
+	model.pendingClick = nil
+	if click.toggle && click.line == model.cursor {
+		return model.toggleLine()
+	}
+	return nil
+}
+
+// Unstages the staged line under the cursor and stages any other change. Only
+// the clicked line is staged or unstaged, not the selection.
+func (model *model) doubleClick() tea.Cmd {
+	prefix, ok := model.cursorSectionPrefix()
+	if !ok {
+		return nil
+	}
+	model.clearSelection()
+	switch prefix {
+	case sectionKeyPrefix[SECTION_STAGED]:
+		return model.unstage()
+	case sectionKeyPrefix[SECTION_UNMERGED], sectionKeyPrefix[SECTION_UNTRACKED], sectionKeyPrefix[SECTION_UNSTAGED]:
+		return model.stage()
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineAtMultilineRows(t *testing.T) {
+	m := initialModel(nil)
+	m.width, m.height = 80, 20
+	m.lines = []line{textLine{text: "first\nwrapped"}, textLine{text: "second"}}
+
+	// The help takes the first three rows
+	assert.Equal(t, -1, m.lineAt(2))
+	assert.Equal(t, 0, m.lineAt(3))
+	assert.Equal(t, 0, m.lineAt(4))
+	assert.Equal(t, 1, m.lineAt(5))
+	assert.Equal(t, -1, m.lineAt(6))
+
+	m.scroll = 1
+	assert.Equal(t, 0, m.lineAt(1))
+	assert.Equal(t, 1, m.lineAt(2))
+}
+
+func TestDoubleClickIgnoresSelection(t *testing.T) {
+	dir := &directory{path: commitTestRepository(t)}
+	os.WriteFile(filepath.Join(dir.path, "new.txt"), []byte("new\n"), 0644)
+	assert.NoError(t, dir.loadStatus())
+
+	m := initialModel([]*directory{dir})
+	m.toggleLine()
+	lineIndex := func(key string) int {
+		return slices.IndexFunc(m.lines, func(l line) bool {
+			keyed_line, ok := l.(keyed)
+			return ok && keyed_line.Key() == key
+		})
+	}
+	m.cursor = lineIndex("staged:file.txt")
+	m.toggleSelection()
+
+	m.click(lineIndex("untracked:new.txt"))
+	m.click(lineIndex("untracked:new.txt"))
+	assert.NoError(t, dir.loadStatus())
+	assert.Empty(t, dir.stat.untracked)
+	assert.Len(t, dir.stat.staged, 2)
+}
@@ -0,0 +1,249 @@
+package git
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Otard95/ngm/lib/slice"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Lines that can be recognized across a refresh, so their open state and the
+// cursor can be restored.
+type keyed interface {
+	Key() string
+}
+
+func (u untrackedLine) Key() string {
+	return "untracked:" + u.file
+}
+func (u unstagedLine) Key() string {
+	return "unstaged:" + u.change.file
+}
+func (s stagedLine) Key() string {
+	return "staged:" + s.change.file
+}
+
+type directoryLoadedMsg struct {
+	path string
+	// The load of the repository the status was read by
+	generation int
+	stat       *status
+	stashes    []stashEntry
+	err        error
+}
+
+// Reads the status of the repository, and its stashes if it has any.
+func readDirectory(path string) (*status, []stashEntry, error) {
+	stat, err := getStatus(path, StatusOptions{noOptionalLocks: true})
+	if err != nil || stat.stashCount == 0 {
+		return stat, nil, err
+	}
+	stashes, err := getStashes(path)
+	return stat, stashes, err
+}
+
+// Reads the status of the repository in the background.
+func loadDirectoryCmd(path string, generation int) tea.Cmd {
+	return func() tea.Msg {
+		msg := directoryLoadedMsg{path: path, generation: generation}
+		msg.stat, msg.stashes, msg.err = readDirectory(path)
+		return msg
+	}
+}
+
+type diffLoadedMsg struct {
+	path string
+	// The generation of the repository when the diff was read
+	generation int
+	dif        []diff
+	err        error
+}
+
+func loadDiffCmd(path string, generation int) tea.Cmd {
+	return func() tea.Msg {
+		msg := diffLoadedMsg{path: path, generation: generation}
+		msg.dif, msg.err = getDiff(path, DiffOptions{})
+		return msg
+	}
+}
+
+func (model *model) isLoading() bool {
+	return slice.Some(model.directories, func(dir *directory) bool {
+		return dir.loading || dir.difLoading || dir.operation != nil || dir.stashLoading()
+	})
+}
+
+// Starts the spinner unless it's already spinning.
+func (model *model) startSpinner() tea.Cmd {
+	if model.spinning {
+		return nil
+	}
+	model.spinning = true
+	return model.spinner.Tick
+}
+
+func (model *model) refresh(path string) tea.Cmd {
+	dir := model.findDirectory(path)
+	if dir == nil {
+		return nil
+	}
+	dir.loading = true
+	dir.loadGeneration++
+	return tea.Batch(loadDirectoryCmd(path, dir.loadGeneration), model.startSpinner())
+}
+
+func (model *model) refreshAll() tea.Cmd {
+	cmds := []tea.Cmd{}
+	for _, dir := range model.directories {
+		cmds = append(cmds, model.refresh(dir.path))
+	}
+	return tea.Batch(cmds...)
+}
+
+func (model *model) findDirectory(path string) *directory {
+	i := slices.IndexFunc(model.directories, func(dir *directory) bool { return dir.path == path })
+	if i == -1 {
+		return nil
+	}
+	return model.directories[i]
+}
+
+func (model *model) directoryLoaded(msg directoryLoadedMsg) tea.Cmd {
+	dir := model.findDirectory(msg.path)
+	// A later read is still running, which may have seen newer changes
+	if dir == nil || msg.generation != dir.loadGeneration {
+		return nil
+	}
+
+	hadError := dir.err != nil
+	dir.stat, dir.stashes, dir.err = msg.stat, msg.stashes, msg.err
+	dir.loading = false
+	if dir.err != nil && !hadError {
+		model.notifyError(fmt.Errorf("Failed to read the status of %s: %w", dir.path, dir.err))
+	}
+
+	// The refs of the stashes change as they're added and removed
+	dir.stashDiffs = nil
+	cmd := model.invalidateDiff(dir)
+	model.rebuildDirectory(dir)
+	if model.filter != FILTER_NONE {
+		model.applyFilter()
+	}
+	return tea.Batch(cmd, model.reloadStashDiffs(dir))
+}
+
+// Starts reading the diff of the repository unless it's already read or being
+// read.
+func (model *model) loadDiff(dir *directory) tea.Cmd {
+	if dir == nil || dir.difLoaded || dir.difLoading {
+		return nil
+	}
+	dir.difLoading = true
+	return tea.Batch(loadDiffCmd(dir.path, dir.difGeneration), model.startSpinner())
+}
+
+// Marks the diff of the repository as outdated. If any of its files are open
+// the diff is re-read right away, showing the old diff until it's done.
+// Otherwise it's read the next time a file is opened. A diff that's already
+// being read is re-read once it's done, since it may be outdated too.
+func (model *model) invalidateDiff(dir *directory) tea.Cmd {
+	dir.difGeneration++
+	hasOpenFiles := slices.ContainsFunc(model.lines, func(l line) bool {
+		toggle_line, ok := l.(toggleable)
+		_, is_dir := l.(*dirLine)
+		return ok && !is_dir && toggle_line.Open() && lineDirectory(l) == dir
+	})
+	if !hasOpenFiles || dir.difLoading {
+		dir.difLoaded = false
+		return nil
+	}
+
+	dir.difLoading = true
+	return tea.Batch(loadDiffCmd(dir.path, dir.difGeneration), model.startSpinner())
+}
+
+func (model *model) diffLoaded(msg diffLoadedMsg) tea.Cmd {
+	dir := model.findDirectory(msg.path)
+	if dir == nil {
+		return nil
+	}
+	if msg.generation != dir.difGeneration {
+		dir.difLoading = false
+		return model.invalidateDiff(dir)
+	}
+
+	dir.dif = msg.dif
+	dir.difLoaded = true
+	dir.difLoading = false
+	if msg.err != nil {
+		model.notifyError(fmt.Errorf("Failed to read the diff of %s: %w", dir.path, msg.err))
+	}
+	model.rebuildDirectory(dir)
+	return nil
+}
+
+// Re-creates the lines of an open directory from its current status, keeping
+// the lines that were open open, and the cursor on the same line if it still
+// exists.
+func (model *model) rebuildDirectory(dir *directory) {
+	i := slices.IndexFunc(model.lines, func(l line) bool {
+		dir_line, ok := l.(*dirLine)
+		return ok && dir_line.dir == dir
+	})
+	if i == -1 {
+		return
+	}
+	dir_line := model.lines[i].(*dirLine)
+	if !dir_line.Open() {
+		return
+	}
+
+	end := i + 1
+	for end < len(model.lines) && lineDirectory(model.lines[end]) == dir {
+		end++
+	}
+
+	open := map[string]bool{}
+	for _, l := range model.lines[i+1 : end] {
+		keyed_line, is_keyed := l.(keyed)
+		toggle_line, is_toggle := l.(toggleable)
+		if is_keyed && is_toggle && toggle_line.Open() {
+			open[keyed_line.Key()] = true
+		}
+	}
+
+	cursorInBlock := model.cursor > i && model.cursor < end
+	cursorKey := ""
+	if keyed_line, ok := model.lines[model.cursor].(keyed); ok && cursorInBlock {
+		cursorKey = keyed_line.Key()
+	}
+
+	block := []line{}
+	for _, child := range lineChildren(dir_line, model.diffOptions) {
+		block = append(block, child)
+		keyed_line, is_keyed := child.(keyed)
+		toggle_line, is_toggle := child.(toggleable)
+		if is_keyed && is_toggle && open[keyed_line.Key()] {
+			toggle_line.SetOpen(true)
+			block = append(block, lineChildren(child, model.diffOptions)...)
+		}
+	}
+	model.lines = slices.Concat(model.lines[:i+1], block, model.lines[end:])
+
+	switch {
+	case model.cursor >= end:
+		model.cursor += len(block) - (end - i - 1)
+	case cursorInBlock:
+		j := slices.IndexFunc(block, func(l line) bool {
+			keyed_line, ok := l.(keyed)
+			return ok && len(cursorKey) > 0 && keyed_line.Key() == cursorKey
+		})
+		if j != -1 {
+			model.cursor = i + 1 + j
+		} else {
+			model.cursor = min(model.cursor, i+len(block))
+		}
+	}
+	model.cursor = max(min(model.cursor, len(model.lines)-1), 0)
+}
@@ -0,0 +1,65 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutdatedDiffIsDropped(t *testing.T) {
+	dir := &directory{path: "repo"}
+	m := initialModel([]*directory{dir})
+
+	m.loadDiff(dir)
+	assert.True(t, dir.difLoading)
+	// The status changes while the diff is being read
+	m.invalidateDiff(dir)
+
+	m.diffLoaded(diffLoadedMsg{path: "repo", generation: 0, dif: []diff{{}}})
+	assert.False(t, dir.difLoaded)
+	assert.False(t, dir.difLoading)
+	assert.Nil(t, dir.dif)
+
+	m.loadDiff(dir)
+	m.diffLoaded(diffLoadedMsg{path: "repo", generation: dir.difGeneration, dif: []diff{{}}})
+	assert.True(t, dir.difLoaded)
+	assert.Len(t, dir.dif, 1)
+}
+
+func TestStashDiffIsLoadedInBackground(t *testing.T) {
+	dir := &directory{path: "repo", stashes: []stashEntry{{ref: "stash@{0}"}}}
+	m := initialModel([]*directory{dir})
+	stash := &stashLine{dir: dir, stash: dir.stashes[0]}
+
+	assert.NotNil(t, m.loadStashDiff(dir, "stash@{0}"))
+	assert.True(t, dir.stashLoading())
+	assert.Equal(t, "  Loading stash…", lineChildren(stash, m.diffOptions)[0].(*textLine).text)
+
+	// The status is read again while the diff is being read
+	dir.stashDiffs = nil
+	m.invalidateDiff(dir)
+	m.stashDiffLoaded(stashDiffLoadedMsg{path: "repo", ref: "stash@{0}", generation: 0})
+	assert.Nil(t, dir.stashDiffs)
+
+	m.loadStashDiff(dir, "stash@{0}")
+	m.stashDiffLoaded(stashDiffLoadedMsg{path: "repo", ref: "stash@{0}", generation: dir.difGeneration, dif: []diff{{}}})
+	assert.False(t, dir.stashLoading())
+	assert.Len(t, dir.stashDiffs["stash@{0}"].dif, 1)
+}
+
+func TestOutdatedStatusIsDropped(t *testing.T) {
+	dir := &directory{path: "repo"}
+	m := initialModel([]*directory{dir})
+
+	m.refresh("repo")
+	// The repository changes while its status is being read
+	m.refresh("repo")
+
+	m.directoryLoaded(directoryLoadedMsg{path: "repo", generation: 1, stat: &status{}})
+	assert.True(t, dir.loading)
+	assert.Nil(t, dir.stat)
+
+	m.directoryLoaded(directoryLoadedMsg{path: "repo", generation: 2, stat: &status{}})
+	assert.False(t, dir.loading)
+	assert.NotNil(t, dir.stat)
+}
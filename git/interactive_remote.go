@@ -0,0 +1,119 @@
+package git
+
+import (
+	"fmt"
+
+	"github.com/Otard95/ngm/lib/slice"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type remoteOperation int
+
+const (
+	PUSH remoteOperation = iota
+	PULL
+	FETCH
+	REMOTE_OPERATION_COUNT
+)
+
+var remoteOperationName = [REMOTE_OPERATION_COUNT]string{"push", "pull", "fetch"}
+var remoteOperationProgress = [REMOTE_OPERATION_COUNT]string{"pushing", "pulling", "fetching"}
+
+func (op remoteOperation) String() string {
+	return remoteOperationName[op]
+}
+
+func (op remoteOperation) Progress() string {
+	return remoteOperationProgress[op]
+}
+
+func (op remoteOperation) run(dir string) (string, error) {
+	switch op {
+	case PUSH:
+		return doPush(dir, []string{})
+	case PULL:
+		return doPull(dir, []string{})
+	}
+	return doFetch(dir, []string{})
+}
+
+type remoteDoneMsg struct {
+	path string
+	op   remoteOperation
+	out  string
+	err  error
+}
+
+// Runs the operation in the background, showing its progress on the line of
+// the repository.
+func (model *model) runRemote(dir *directory, op remoteOperation) tea.Cmd {
+	if dir == nil || dir.operation != nil {
+		return nil
+	}
+	dir.operation = &op
+
+	path := dir.path
+	return tea.Batch(
+		func() tea.Msg {
+			out, err := op.run(path)
+			return remoteDoneMsg{path: path, op: op, out: out, err: commandError([]byte(out), err)}
+		},
+		model.startSpinner(),
+	)
+}
+
+// Runs the operation in the repository under the cursor, or in every selected
+// repository.
+func (model *model) remoteCursor(op remoteOperation) tea.Cmd {
+	if len(model.selection) > 0 {
+		dirs := model.selectedDirectories()
+		model.clearSelection()
+		return tea.Batch(slice.Map(dirs, func(dir *directory, _ int) tea.Cmd {
+			return model.runRemote(dir, op)
+		})...)
+	}
+	if len(model.lines) == 0 {
+		return nil
+	}
+	return model.runRemote(lineDirectory(model.lines[model.cursor]), op)
+}
+
+// Runs the operation in every repository it makes sense for. Pushing only
+// happens in repositories with commits ahead of the upstream, while pulling
+// and fetching happens in all repositories with an upstream.
+func (model *model) remoteAll(op remoteOperation) tea.Cmd {
+	dirs := slice.Filter(model.directories, func(dir *directory, _ int) bool {
+		if dir.stat == nil || dir.stat.branch.upstream == nil {
+			return false
+		}
+		if op == PUSH {
+			return dir.stat.branch.upstream.ahead > 0
+		}
+		return true
+	})
+	if len(dirs) == 0 {
+		model.notify(fmt.Sprintf("No repositories to %s", op))
+		return nil
+	}
+
+	return tea.Batch(slice.Map(dirs, func(dir *directory, _ int) tea.Cmd {
+		return model.runRemote(dir, op)
+	})...)
+}
+
+func (model *model) remoteDone(msg remoteDoneMsg) tea.Cmd {
+	dir := model.findDirectory(msg.path)
+	if dir == nil {
+		return nil
+	}
+	dir.operation = nil
+
+	if msg.err != nil {
+		model.notifyError(fmt.Errorf("Failed to %s %s: %w", msg.op, msg.path, msg.err))
+	} else if model.notification == nil || !model.notification.err {
+		model.notify(fmt.Sprintf("Finished %s in %s", msg.op.Progress(), msg.path))
+	}
+
+	// Read the status again to update the ahead/behind counters
+	return model.refresh(msg.path)
+}
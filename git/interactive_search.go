@@ -0,0 +1,250 @@
+package git
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Otard95/ngm/lib/fuzzy"
+	"github.com/Otard95/ngm/lib/slice"
+	"github.com/Otard95/ngm/ui"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var search_style = lipgloss.NewStyle().Foreground(ui.ColorSubtext0)
+
+type dirFilter int
+
+const (
+	FILTER_NONE dirFilter = iota
+	FILTER_DIRTY
+	FILTER_STAGED
+	FILTER_COUNT
+)
+
+var dirFilterName = [FILTER_COUNT]string{"all", "with changes", "with staged changes"}
+
+func (f dirFilter) String() string {
+	return dirFilterName[f]
+}
+
+func (f dirFilter) Matches(dir *directory) bool {
+	// Repositories that haven't loaded or failed are always shown
+	if dir.stat == nil {
+		return true
+	}
+	switch f {
+	case FILTER_DIRTY:
+		return !dir.stat.IsClean()
+	case FILTER_STAGED:
+		return len(dir.stat.staged) > 0
+	}
+	return true
+}
+
+// A repository or file matching the search. The key is the `keyed.Key()` of
+// the file line, or empty for the repository itself.
+type searchMatch struct {
+	dir   *directory
+	key   string
+	score int
+}
+
+func newSearchInput() textinput.Model {
+	t := textinput.New()
+	t.Prompt = "/"
+	t.Placeholder = "search repositories and files"
+	return t
+}
+
+func (model *model) startSearch() {
+	model.searching = true
+	model.searchInput.SetValue("")
+	model.searchInput.Focus()
+	model.matches = nil
+}
+
+func (model *model) endSearch(keep bool) {
+	model.searching = false
+	model.searchInput.Blur()
+	if !keep {
+		model.searchInput.SetValue("")
+		model.matches = nil
+	}
+}
+
+// Searches every visible repository, including the files of repositories that
+// are closed.
+func (model *model) search(query string) []searchMatch {
+	matches := []searchMatch{}
+	match := func(dir *directory, key, text string) {
+		if score, ok := fuzzy.Match(query, text); ok {
+			matches = append(matches, searchMatch{dir: dir, key: key, score: score})
+		}
+	}
+
+	for _, dir := range model.directories {
+		if !model.filter.Matches(dir) {
+			continue
+		}
+		match(dir, "", dir.path)
+		if dir.stat == nil {
+			continue
+		}
+		for _, c := range dir.stat.unmerged {
+			match(dir, unmergedLine{change: c}.Key(), c.file)
+		}
+		for _, file := range dir.stat.untracked {
+			match(dir, untrackedLine{file: file}.Key(), file)
+		}
+		for _, c := range dir.stat.unstaged {
+			match(dir, unstagedLine{change: c}.Key(), c.file)
+		}
+		for _, c := range dir.stat.staged {
+			match(dir, stagedLine{change: c}.Key(), c.file)
+		}
+	}
+	return matches
+}
+
+// Re-runs the search as the query changes and moves to the best match.
+func (model *model) updateSearch() {
+	query := model.searchInput.Value()
+	if len(query) == 0 {
+		model.matches = nil
+		return
+	}
+
+	model.matches = model.search(query)
+	if len(model.matches) == 0 {
+		return
+	}
+	best := 0
+	for i, match := range model.matches {
+		if match.score > model.matches[best].score {
+			best = i
+		}
+	}
+	model.matchIndex = best
+	model.revealMatch(model.matches[best])
+}
+
+func (model *model) nextMatch(delta int) {
+	// Search again in case the repositories changed since the last jump
+	if query := model.searchInput.Value(); len(query) > 0 {
+		model.matches = model.search(query)
+	}
+	if len(model.matches) == 0 {
+		return
+	}
+	model.matchIndex = (model.matchIndex + delta + len(model.matches)) % len(model.matches)
+	model.revealMatch(model.matches[model.matchIndex])
+}
+
+// Moves the cursor to the match, opening the repository if the match is one of
+// its files.
+func (model *model) revealMatch(match searchMatch) {
+	i := slices.IndexFunc(model.lines, func(l line) bool {
+		dir_line, ok := l.(*dirLine)
+		return ok && dir_line.dir == match.dir
+	})
+	if i == -1 {
+		return
+	}
+	model.cursor = i
+
+	if len(match.key) > 0 {
+		if toggle_line := model.lines[i].(*dirLine); !toggle_line.Open() {
+			model.toggleLine()
+		}
+		j := slices.IndexFunc(model.lines[i:], func(l line) bool {
+			keyed_line, ok := l.(keyed)
+			return ok && keyed_line.Key() == match.key
+		})
+		if j != -1 {
+			model.cursor = i + j
+		}
+	}
+	model.scrollToCursor()
+}
+
+func (model *model) searchView() string {
+	if !model.searching && len(model.searchInput.Value()) == 0 {
+		return ""
+	}
+
+	count := ""
+	if len(model.matches) > 0 {
+		count = fmt.Sprintf(" [%d/%d]", model.matchIndex+1, len(model.matches))
+	} else if len(model.searchInput.Value()) > 0 {
+		count = " [no matches]"
+	}
+
+	if model.searching {
+		return model.searchInput.View() + search_style.Render(count)
+	}
+	return search_style.Render("/" + model.searchInput.Value() + count + " (n/N to jump)")
+}
+
+func (model *model) cycleFilter() {
+	model.filter = (model.filter + 1) % FILTER_COUNT
+	model.applyFilter()
+	if model.filter == FILTER_NONE {
+		model.notify("Showing all repositories")
+	} else {
+		model.notify("Showing repositories " + model.filter.String())
+	}
+}
+
+// Hides the repositories not matching the filter, keeping the lines of the
+// visible repositories as they were.
+func (model *model) applyFilter() {
+	var current line
+	if model.cursor < len(model.lines) {
+		current = model.lines[model.cursor]
+	}
+
+	blocks := map[*directory][]line{}
+	for _, l := range model.lines {
+		dir := lineDirectory(l)
+		blocks[dir] = append(blocks[dir], l)
+	}
+
+	lines := []line{}
+	for _, dir := range model.directories {
+		if !model.filter.Matches(dir) {
+			continue
+		}
+		if block, ok := blocks[dir]; ok {
+			lines = append(lines, block...)
+		} else {
+			lines = append(lines, &dirLine{text: dir.path, dir: dir})
+		}
+	}
+	model.lines = lines
+
+	if i := slices.Index(model.lines, current); i != -1 {
+		model.cursor = i
+	} else {
+		model.cursor = max(min(model.cursor, len(model.lines)-1), 0)
+	}
+	model.scrollToCursor()
+}
+
+// The repositories passing the current filter.
+func (model *model) shownDirectories() []*directory {
+	return slice.Filter(model.directories, func(dir *directory, _ int) bool {
+		return model.filter.Matches(dir)
+	})
+}
+
+// Joins the parts of the footer that are currently shown.
+func (model *model) footerView() string {
+	return slice.Join(
+		slice.Filter(
+			[]string{model.notificationView(), model.confirmationView(), model.selectionView(), model.stashView(), model.searchView()},
+			func(s string, _ int) bool { return len(s) > 0 },
+		),
+		"\n",
+	)
+}
@@ -0,0 +1,346 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Otard95/ngm/lib/slice"
+	"github.com/Otard95/ngm/ui"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var selected_style = lipgloss.NewStyle().Foreground(ui.ColorMauve)
+
+type section int
+
+const (
+	SECTION_UNMERGED section = iota
+	SECTION_UNTRACKED
+	SECTION_UNSTAGED
+	SECTION_STAGED
+	SECTION_STASHES
+	SECTION_COUNT
+)
+
+// The prefix of the keys of the lines in each section.
+var sectionKeyPrefix = [SECTION_COUNT]string{"unmerged:", "untracked:", "unstaged:", "staged:", "stash:"}
+
+// The header of a section of a repository, like "Unstaged (3)".
+type sectionLine struct {
+	text    string
+	section section
+	childLine
+}
+
+func (sectionLine) isLine() {}
+func (s sectionLine) Render() string {
+	return s.text
+}
+func (s sectionLine) Key() string {
+	return "section:" + sectionKeyPrefix[s.section]
+}
+
+// A repository, when the key is empty, or a file of a repository.
+type selectionKey struct {
+	dir *directory
+	key string
+}
+
+// The selection key of the line, if it's a repository or a file.
+func lineSelectionKey(l line) (selectionKey, bool) {
+	switch v := l.(type) {
+	case *dirLine:
+		return selectionKey{dir: v.dir}, true
+	case *untrackedLine, *unstagedLine, *stagedLine, *unmergedLine:
+		return selectionKey{dir: lineDirectory(l), key: l.(keyed).Key()}, true
+	}
+	return selectionKey{}, false
+}
+
+func (model *model) isSelected(l line) bool {
+	selection_key, ok := lineSelectionKey(l)
+	return ok && model.selection[selection_key]
+}
+
+// Selects or unselects the line under the cursor. On a section header, every
+// file of the section is selected instead.
+func (model *model) toggleSelection() {
+	if len(model.lines) == 0 {
+		return
+	}
+	current := model.lines[model.cursor]
+	if _, ok := current.(*sectionLine); ok {
+		model.selectSection()
+		return
+	}
+
+	if selection_key, ok := lineSelectionKey(current); ok {
+		model.setSelected([]selectionKey{selection_key}, !model.selection[selection_key])
+	}
+}
+
+// Selects every file in the section under the cursor, or every shown repository
+// when on a repository. If they're all selected already they're unselected.
+func (model *model) selectSection() {
+	if len(model.lines) == 0 {
+		return
+	}
+	current := model.lines[model.cursor]
+	dir := lineDirectory(current)
+	if dir == nil {
+		return
+	}
+
+	keys := []selectionKey{}
+	if _, ok := current.(*dirLine); ok {
+		keys = slice.Map(model.shownDirectories(), func(dir *directory, _ int) selectionKey {
+			return selectionKey{dir: dir}
+		})
+	} else if prefix, ok := model.cursorSectionPrefix(); ok {
+		keys = slice.Filter(directoryFileKeys(dir), func(k selectionKey, _ int) bool {
+			return strings.HasPrefix(k.key, prefix)
+		})
+	}
+	model.setSelected(keys, !slice.Every(keys, func(k selectionKey) bool { return model.selection[k] }))
+}
+
+// Selects every repository and file matching the current search.
+func (model *model) selectMatches() {
+	query := model.searchInput.Value()
+	if len(query) == 0 {
+		model.notify("Search with / first to select the matches")
+		return
+	}
+	model.setSelected(slice.Map(model.search(query), func(match searchMatch, _ int) selectionKey {
+		return selectionKey{dir: match.dir, key: match.key}
+	}), true)
+}
+
+func (model *model) setSelected(keys []selectionKey, selected bool) {
+	if model.selection == nil {
+		model.selection = map[selectionKey]bool{}
+	}
+	for _, k := range keys {
+		if selected {
+			model.selection[k] = true
+		} else {
+			delete(model.selection, k)
+		}
+	}
+}
+
+func (model *model) clearSelection() {
+	model.selection = nil
+}
+
+// The key prefix of the section the cursor is in, either on its header or on
+// one of its files.
+func (model *model) cursorSectionPrefix() (string, bool) {
+	for l := model.lines[model.cursor]; l != nil; {
+		if section_line, ok := l.(*sectionLine); ok {
+			return sectionKeyPrefix[section_line.section], true
+		}
+		if keyed_line, ok := l.(keyed); ok {
+			key := keyed_line.Key()
+			return key[:strings.Index(key, ":")+1], true
+		}
+		parented_line, ok := l.(parented)
+		if !ok {
+			break
+		}
+		l = parented_line.Parent()
+	}
+	return "", false
+}
+
+// The selection keys of every file of the repository.
+func directoryFileKeys(dir *directory) []selectionKey {
+	if dir.stat == nil {
+		return nil
+	}
+	keys := []selectionKey{}
+	add := func(key string) {
+		keys = append(keys, selectionKey{dir: dir, key: key})
+	}
+	for _, c := range dir.stat.unmerged {
+		add(unmergedLine{change: c}.Key())
+	}
+	for _, file := range dir.stat.untracked {
+		add(untrackedLine{file: file}.Key())
+	}
+	for _, c := range dir.stat.unstaged {
+		add(unstagedLine{change: c}.Key())
+	}
+	for _, c := range dir.stat.staged {
+		add(stagedLine{change: c}.Key())
+	}
+	return keys
+}
+
+// The files of the repository whose keys match.
+func directoryFiles(dir *directory, matches func(key string) bool) fileSet {
+	files := fileSet{}
+	if dir.stat == nil {
+		return files
+	}
+	files.unmerged = slice.Filter(dir.stat.unmerged, func(c unmergedChange, _ int) bool {
+		return matches(unmergedLine{change: c}.Key())
+	})
+	files.untracked = slice.Filter(dir.stat.untracked, func(file string, _ int) bool {
+		return matches(untrackedLine{file: file}.Key())
+	})
+	files.unstaged = slice.Filter(dir.stat.unstaged, func(c change, _ int) bool {
+		return matches(unstagedLine{change: c}.Key())
+	})
+	files.staged = slice.Filter(dir.stat.staged, func(c change, _ int) bool {
+		return matches(stagedLine{change: c}.Key())
+	})
+	return files
+}
+
+type target struct {
+	dir   *directory
+	files fileSet
+}
+
+// The files an action applies to. This is the selection when there is one.
+// Otherwise it's the file under the cursor, every file of the section under the
+// cursor, or every file of the repository under the cursor.
+func (model *model) targets() []target {
+	targets := []target{}
+	add := func(dir *directory, matches func(key string) bool) {
+		if files := directoryFiles(dir, matches); files.Count() > 0 {
+			targets = append(targets, target{dir: dir, files: files})
+		}
+	}
+
+	if len(model.selection) > 0 {
+		for _, dir := range model.directories {
+			if model.selection[selectionKey{dir: dir}] {
+				add(dir, func(string) bool { return true })
+			} else {
+				add(dir, func(key string) bool { return model.selection[selectionKey{dir: dir, key: key}] })
+			}
+		}
+		return targets
+	}
+
+	if len(model.lines) == 0 {
+		return targets
+	}
+	current := model.lines[model.cursor]
+	dir := lineDirectory(current)
+	if dir == nil {
+		return targets
+	}
+
+	for l := current; l != nil; {
+		switch v := l.(type) {
+		case *dirLine:
+			// Only the repository line itself targets the whole repository, not
+			// lines like "No changes"
+			if l == current {
+				add(dir, func(string) bool { return true })
+			}
+			return targets
+		case *sectionLine:
+			add(dir, func(key string) bool { return strings.HasPrefix(key, sectionKeyPrefix[v.section]) })
+			return targets
+		}
+		if selection_key, ok := lineSelectionKey(l); ok {
+			add(dir, func(key string) bool { return key == selection_key.key })
+			return targets
+		}
+		parented_line, ok := l.(parented)
+		if !ok {
+			break
+		}
+		l = parented_line.Parent()
+	}
+	return targets
+}
+
+// The repositories with anything selected.
+func (model *model) selectedDirectories() []*directory {
+	return slice.Filter(model.directories, func(dir *directory, _ int) bool {
+		for k := range model.selection {
+			if k.dir == dir {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// The selected repositories, or every shown repository if nothing is selected.
+func (model *model) selectedOrShownDirectories() []*directory {
+	if len(model.selection) > 0 {
+		return model.selectedDirectories()
+	}
+	return model.shownDirectories()
+}
+
+// Runs the action on the files of each target, then refreshes the targeted
+// repositories and clears the selection.
+func (model *model) bulkAction(name string, action func(dir string, files fileSet) error) tea.Cmd {
+	targets := model.targets()
+	errs := slice.ParallelMap(targets, func(t target, _ int) error {
+		if err := action(t.dir.path, t.files); err != nil {
+			return fmt.Errorf("Failed to %s in %s: %w", name, t.dir.path, err)
+		}
+		return nil
+	})
+	if err := errors.Join(errs...); err != nil {
+		model.notifyError(err)
+	}
+
+	model.clearSelection()
+	return tea.Batch(slice.Map(targets, func(t target, _ int) tea.Cmd {
+		return model.refreshStatus(t.dir)
+	})...)
+}
+
+func (model *model) stage() tea.Cmd {
+	return model.bulkAction("stage", stageFiles)
+}
+
+func (model *model) unstage() tea.Cmd {
+	return model.bulkAction("unstage", unstageFiles)
+}
+
+// Asks to discard the changes to the targeted files, since they can't be
+// recovered.
+func (model *model) discard() {
+	targets := model.targets()
+	count := 0
+	for _, t := range targets {
+		count += t.files.Count() - len(t.files.unmerged)
+	}
+	if count == 0 {
+		return
+	}
+
+	model.confirm(
+		fmt.Sprintf("Discard the changes to %d files in %d repositories?", count, len(targets)),
+		slice.Map(targets, func(t target, _ int) *directory { return t.dir }),
+		func() error {
+			errs := slice.ParallelMap(targets, func(t target, _ int) error {
+				if err := discardFiles(t.dir.path, t.files); err != nil {
+					return fmt.Errorf("Failed to discard in %s: %w", t.dir.path, err)
+				}
+				return nil
+			})
+			return errors.Join(errs...)
+		},
+	)
+	model.clearSelection()
+}
+
+func (model *model) selectionView() string {
+	if len(model.selection) == 0 {
+		return ""
+	}
+	return selected_style.Render(fmt.Sprintf(" %d selected (Esc to clear)", len(model.selection)))
+}
@@ -0,0 +1,181 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Otard95/ngm/lib/slice"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type stashLine struct {
+	dir   *directory
+	stash stashEntry
+	toggle
+	childLine
+}
+
+func (stashLine) isLine() {}
+func (s stashLine) Render() string {
+	return "  " + help_key_style.Render(s.stash.ref) + " " + s.stash.subject
+}
+func (s stashLine) Key() string {
+	return "stash:" + s.stash.ref
+}
+
+type stashDiff struct {
+	loading bool
+	dif     []diff
+	err     error
+}
+
+type stashDiffLoadedMsg struct {
+	path string
+	ref  string
+	// The generation of the repository when the diff was read
+	generation int
+	dif        []diff
+	err        error
+}
+
+func loadStashDiffCmd(path string, ref string, generation int) tea.Cmd {
+	return func() tea.Msg {
+		msg := stashDiffLoadedMsg{path: path, ref: ref, generation: generation}
+		msg.dif, msg.err = getStashDiff(path, ref)
+		return msg
+	}
+}
+
+func (dir *directory) stashLoading() bool {
+	for _, stash_diff := range dir.stashDiffs {
+		if stash_diff.loading {
+			return true
+		}
+	}
+	return false
+}
+
+// Starts reading the diff of the stash unless it's already read or being read.
+func (model *model) loadStashDiff(dir *directory, ref string) tea.Cmd {
+	if _, ok := dir.stashDiffs[ref]; ok {
+		return nil
+	}
+	if dir.stashDiffs == nil {
+		dir.stashDiffs = map[string]*stashDiff{}
+	}
+	dir.stashDiffs[ref] = &stashDiff{loading: true}
+	return tea.Batch(loadStashDiffCmd(dir.path, ref, dir.difGeneration), model.startSpinner())
+}
+
+// Re-reads the diffs of the open stashes of the repository.
+func (model *model) reloadStashDiffs(dir *directory) tea.Cmd {
+	cmds := []tea.Cmd{}
+	for _, l := range model.lines {
+		if stash, ok := l.(*stashLine); ok && stash.dir == dir && stash.Open() {
+			cmds = append(cmds, model.loadStashDiff(dir, stash.stash.ref))
+		}
+	}
+	return tea.Batch(cmds...)
+}
+
+// Shows the diff of the stash, unless the stashes changed since it was read,
+// in which case it's already being read again.
+func (model *model) stashDiffLoaded(msg stashDiffLoadedMsg) {
+	dir := model.findDirectory(msg.path)
+	if dir == nil || msg.generation != dir.difGeneration {
+		return
+	}
+	dir.stashDiffs[msg.ref] = &stashDiff{dif: msg.dif, err: msg.err}
+	model.rebuildDirectory(dir)
+}
+
+func newStashInput() textinput.Model {
+	t := textinput.New()
+	t.Prompt = "Stash message: "
+	t.Placeholder = "optional"
+	return t
+}
+
+// Asks for the message to stash the changes of the repositories with.
+func (model *model) startStash(dirs []*directory) {
+	model.stashDirs = slice.Filter(dirs, func(dir *directory, _ int) bool {
+		return dir != nil && dir.stat != nil && len(dir.stat.staged)+len(dir.stat.unstaged) > 0
+	})
+	if len(model.stashDirs) == 0 {
+		model.notify("Nothing to stash")
+		return
+	}
+	model.stashing = true
+	model.stashInput.SetValue("")
+	model.stashInput.Focus()
+}
+
+func (model *model) cancelStash() {
+	model.stashing = false
+	model.stashInput.Blur()
+}
+
+func (model *model) submitStash() tea.Cmd {
+	message := model.stashInput.Value()
+	model.cancelStash()
+
+	errs := slice.ParallelMap(model.stashDirs, func(dir *directory, _ int) error {
+		if err := doStash(dir.path, message); err != nil {
+			return fmt.Errorf("Failed to stash the changes of %s: %w", dir.path, err)
+		}
+		return nil
+	})
+	if err := errors.Join(errs...); err != nil {
+		model.notifyError(err)
+	} else {
+		model.notify(fmt.Sprintf("Stashed the changes of %d repositories", len(model.stashDirs)))
+	}
+	return tea.Batch(slice.Map(model.stashDirs, func(dir *directory, _ int) tea.Cmd {
+		return model.refresh(dir.path)
+	})...)
+}
+
+func (model *model) stashView() string {
+	if !model.stashing {
+		return ""
+	}
+	return model.stashInput.View() + search_style.Render(
+		fmt.Sprintf(" (%d repositories, Enter to stash, Esc to cancel)", len(model.stashDirs)),
+	)
+}
+
+// Runs the action on the stash under the cursor, if the cursor is on one.
+func (model *model) stashAction(name string, action func(dir string, ref string) error) tea.Cmd {
+	if len(model.lines) == 0 {
+		return nil
+	}
+	stash, ok := model.lines[model.cursor].(*stashLine)
+	if !ok {
+		return nil
+	}
+	if err := action(stash.dir.path, stash.stash.ref); err != nil {
+		model.notifyError(fmt.Errorf("Failed to %s %s: %w", name, stash.stash.ref, err))
+	}
+	return model.refresh(stash.dir.path)
+}
+
+func (model *model) dropStash() {
+	if len(model.lines) == 0 {
+		return
+	}
+	stash, ok := model.lines[model.cursor].(*stashLine)
+	if !ok {
+		return
+	}
+	model.confirm(
+		fmt.Sprintf("Drop %s in %s?", stash.stash.ref, stash.dir.path),
+		[]*directory{stash.dir},
+		func() error {
+			if err := doStashDrop(stash.dir.path, stash.stash.ref); err != nil {
+				return fmt.Errorf("Failed to drop %s: %w", stash.stash.ref, err)
+			}
+			return nil
+		},
+	)
+}
@@ -0,0 +1,216 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Otard95/ngm/lib/slice"
+	"github.com/charmbracelet/bubbles/key"
+)
+
+type keymap struct {
+	down, up, toggle, help, quit                  key.Binding
+	stage, unstage, discard                       key.Binding
+	commit, commitEditor, amend, fixup            key.Binding
+	refresh, search, nextMatch, prevMatch, filter key.Binding
+	push, pushAll, pull, pullAll, fetch, fetchAll key.Binding
+	branch, branchAll, log, logAll                key.Binding
+	stash, stashAll, apply, pop, drop             key.Binding
+	ours, theirs, edit, mergetool                 key.Binding
+	selectLine, selectSection, selectMatches      key.Binding
+	clearSelection, sideBySide                    key.Binding
+	choose, newBranch, renameBranch               key.Binding
+	deleteBranch, forceDeleteBranch               key.Binding
+	toggleAmend, toggleSignoff                    key.Binding
+	toggleGpgSign, toggleNoVerify                 key.Binding
+}
+
+type keyScope int
+
+const (
+	// The list of repositories
+	SCOPE_MAIN keyScope = iota
+	// The branch, log and fixup panels, which also move with up and down
+	SCOPE_PANEL
+	// The commit screen, where other keys are typed into the message
+	SCOPE_COMMIT
+	SCOPE_COUNT
+)
+
+var scopeNames = [SCOPE_COUNT]string{
+	SCOPE_MAIN:   "",
+	SCOPE_PANEL:  "Panels",
+	SCOPE_COMMIT: "Commit",
+}
+
+// A binding as it can be configured. The help screen is generated from these,
+// in this order.
+type keyDefinition struct {
+	// The name in the `[keys]` section of the config
+	name    string
+	binding func(km *keymap) *key.Binding
+	keys    []string
+	// Shown in the short help at the top of the view
+	short string
+	// Shown on the help screen
+	description string
+	scope       keyScope
+}
+
+var keyDefinitions = []keyDefinition{
+	{"quit", func(km *keymap) *key.Binding { return &km.quit }, []string{"q", "ctrl+c"}, "quit", "Quit", SCOPE_MAIN},
+	{"up", func(km *keymap) *key.Binding { return &km.up }, []string{"up", "k"}, "up", "Move the cursor up", SCOPE_MAIN},
+	{"down", func(km *keymap) *key.Binding { return &km.down }, []string{"down", "j"}, "down", "Move the cursor down", SCOPE_MAIN},
+	{"toggle", func(km *keymap) *key.Binding { return &km.toggle }, []string{"tab", "space", "="}, "toggle", "Open/close the line under the cursor", SCOPE_MAIN},
+	{"stage", func(km *keymap) *key.Binding { return &km.stage }, []string{"s"}, "stage", "Stage the change, section or repository under the cursor, or the selection", SCOPE_MAIN},
+	{"unstage", func(km *keymap) *key.Binding { return &km.unstage }, []string{"u"}, "unstage", "Unstage the change, section or repository under the cursor, or the selection", SCOPE_MAIN},
+	{"discard", func(km *keymap) *key.Binding { return &km.discard }, []string{"D"}, "discard", "Discard the change, section or repository under the cursor, or the selection", SCOPE_MAIN},
+	{"commit", func(km *keymap) *key.Binding { return &km.commit }, []string{"c"}, "commit", "Commit the staged changes of all, or the selected, repositories", SCOPE_MAIN},
+	{"commitEditor", func(km *keymap) *key.Binding { return &km.commitEditor }, []string{"C"}, "commit in $EDITOR", "Write the commit message in $GIT_EDITOR/$EDITOR", SCOPE_MAIN},
+	{"amend", func(km *keymap) *key.Binding { return &km.amend }, []string{"A"}, "amend", "Amend the last commit", SCOPE_MAIN},
+	{"fixup", func(km *keymap) *key.Binding { return &km.fixup }, []string{"F"}, "fixup", "Create fixup commits for the staged changes", SCOPE_MAIN},
+	{"sideBySide", func(km *keymap) *key.Binding { return &km.sideBySide }, []string{"|"}, "side by side", "Toggle showing diffs side by side", SCOPE_MAIN},
+	{"refresh", func(km *keymap) *key.Binding { return &km.refresh }, []string{"r"}, "refresh", "Refresh the status of all repositories", SCOPE_MAIN},
+	{"search", func(km *keymap) *key.Binding { return &km.search }, []string{"/"}, "search", "Search repositories and files", SCOPE_MAIN},
+	{"nextMatch", func(km *keymap) *key.Binding { return &km.nextMatch }, []string{"n"}, "next match", "Jump to the next search match", SCOPE_MAIN},
+	{"prevMatch", func(km *keymap) *key.Binding { return &km.prevMatch }, []string{"N"}, "previous match", "Jump to the previous search match", SCOPE_MAIN},
+	{"filter", func(km *keymap) *key.Binding { return &km.filter }, []string{"f"}, "filter", "Cycle between showing all, changed or staged repositories", SCOPE_MAIN},
+	{"selectLine", func(km *keymap) *key.Binding { return &km.selectLine }, []string{"x"}, "select", "Select the change or repository under the cursor", SCOPE_MAIN},
+	{"selectSection", func(km *keymap) *key.Binding { return &km.selectSection }, []string{"X"}, "select section", "Select the section under the cursor, or all repositories", SCOPE_MAIN},
+	{"selectMatches", func(km *keymap) *key.Binding { return &km.selectMatches }, []string{"*"}, "select matches", "Select everything matching the search", SCOPE_MAIN},
+	{"clearSelection", func(km *keymap) *key.Binding { return &km.clearSelection }, []string{"esc"}, "clear selection", "Clear the selection", SCOPE_MAIN},
+	{"push", func(km *keymap) *key.Binding { return &km.push }, []string{"p"}, "push", "Push the repository under the cursor, or the selected ones", SCOPE_MAIN},
+	{"pushAll", func(km *keymap) *key.Binding { return &km.pushAll }, []string{"P"}, "push all ahead", "Push all repositories with commits ahead of upstream", SCOPE_MAIN},
+	{"pull", func(km *keymap) *key.Binding { return &km.pull }, []string{"l"}, "pull", "Pull the repository under the cursor, or the selected ones", SCOPE_MAIN},
+	{"pullAll", func(km *keymap) *key.Binding { return &km.pullAll }, []string{"L"}, "pull all", "Pull all repositories with an upstream", SCOPE_MAIN},
+	{"fetch", func(km *keymap) *key.Binding { return &km.fetch }, []string{"e"}, "fetch", "Fetch the repository under the cursor, or the selected ones", SCOPE_MAIN},
+	{"fetchAll", func(km *keymap) *key.Binding { return &km.fetchAll }, []string{"E"}, "fetch all", "Fetch all repositories with an upstream", SCOPE_MAIN},
+	{"branch", func(km *keymap) *key.Binding { return &km.branch }, []string{"b"}, "branches", "Show the branches of the repository under the cursor", SCOPE_MAIN},
+	{"branchAll", func(km *keymap) *key.Binding { return &km.branchAll }, []string{"B"}, "branches of all shown", "Show the branches of the selected or all shown repositories", SCOPE_MAIN},
+	{"log", func(km *keymap) *key.Binding { return &km.log }, []string{"o"}, "log", "Show the log of the repository under the cursor", SCOPE_MAIN},
+	{"logAll", func(km *keymap) *key.Binding { return &km.logAll }, []string{"O"}, "log of all shown", "Show the log of the selected or all shown repositories by date", SCOPE_MAIN},
+	{"stash", func(km *keymap) *key.Binding { return &km.stash }, []string{"z"}, "stash", "Stash the changes of the repository under the cursor", SCOPE_MAIN},
+	{"stashAll", func(km *keymap) *key.Binding { return &km.stashAll }, []string{"Z"}, "stash all", "Stash the changes of the selected or all shown repositories", SCOPE_MAIN},
+	{"apply", func(km *keymap) *key.Binding { return &km.apply }, []string{"a"}, "apply stash", "Apply the stash under the cursor", SCOPE_MAIN},
+	{"pop", func(km *keymap) *key.Binding { return &km.pop }, []string{"g"}, "pop stash", "Pop the stash under the cursor", SCOPE_MAIN},
+	{"drop", func(km *keymap) *key.Binding { return &km.drop }, []string{"d"}, "drop stash", "Drop the stash under the cursor", SCOPE_MAIN},
+	{"ours", func(km *keymap) *key.Binding { return &km.ours }, []string{"<"}, "take ours", "Resolve the conflict under the cursor with our version", SCOPE_MAIN},
+	{"theirs", func(km *keymap) *key.Binding { return &km.theirs }, []string{">"}, "take theirs", "Resolve the conflict under the cursor with their version", SCOPE_MAIN},
+	{"edit", func(km *keymap) *key.Binding { return &km.edit }, []string{"v"}, "edit conflict", "Open the conflicted file under the cursor in $EDITOR", SCOPE_MAIN},
+	{"mergetool", func(km *keymap) *key.Binding { return &km.mergetool }, []string{"m"}, "mergetool", "Open the conflicted file under the cursor in the merge tool", SCOPE_MAIN},
+	{"help", func(km *keymap) *key.Binding { return &km.help }, []string{"h"}, "help", "Toggle this help screen", SCOPE_MAIN},
+	{"choose", func(km *keymap) *key.Binding { return &km.choose }, []string{"enter", " "}, "choose", "Check out the branch, or pick the commit to fix up, under the cursor", SCOPE_PANEL},
+	{"newBranch", func(km *keymap) *key.Binding { return &km.newBranch }, []string{"n"}, "new branch", "Create a branch from HEAD in the panel's repositories", SCOPE_PANEL},
+	{"renameBranch", func(km *keymap) *key.Binding { return &km.renameBranch }, []string{"r"}, "rename", "Rename the branch under the cursor", SCOPE_PANEL},
+	{"deleteBranch", func(km *keymap) *key.Binding { return &km.deleteBranch }, []string{"d"}, "delete", "Delete the branch under the cursor", SCOPE_PANEL},
+	{"forceDeleteBranch", func(km *keymap) *key.Binding { return &km.forceDeleteBranch }, []string{"D"}, "force delete", "Delete the branch under the cursor even if it isn't merged", SCOPE_PANEL},
+	{"toggleAmend", func(km *keymap) *key.Binding { return &km.toggleAmend }, []string{"alt+a"}, "amend", "Toggle amending the last commit", SCOPE_COMMIT},
+	{"toggleSignoff", func(km *keymap) *key.Binding { return &km.toggleSignoff }, []string{"alt+s"}, "sign-off", "Toggle adding a Signed-off-by trailer", SCOPE_COMMIT},
+	{"toggleGpgSign", func(km *keymap) *key.Binding { return &km.toggleGpgSign }, []string{"alt+g"}, "gpg-sign", "Toggle signing the commit", SCOPE_COMMIT},
+	{"toggleNoVerify", func(km *keymap) *key.Binding { return &km.toggleNoVerify }, []string{"alt+n"}, "no-verify", "Toggle skipping the commit hooks", SCOPE_COMMIT},
+}
+
+// Presets replace the default keys of some bindings. Anything configured in
+// the `[keys]` section replaces the keys of the preset.
+var keymapPresets = map[string]map[string][]string{
+	"default": {},
+	"vim": {
+		"help":       {"?"},
+		"toggle":     {"tab", "space", "enter"},
+		"selectLine": {"x", "V"},
+	},
+	// Loosely follows magit
+	"emacs": {
+		"up":             {"up", "ctrl+p"},
+		"down":           {"down", "ctrl+n"},
+		"toggle":         {"tab", "enter"},
+		"discard":        {"k"},
+		"refresh":        {"g"},
+		"pop":            {"G"},
+		"search":         {"ctrl+s"},
+		"selectLine":     {"ctrl+@"},
+		"clearSelection": {"ctrl+g", "esc"},
+		"help":           {"?", "ctrl+h"},
+	},
+}
+
+// Shows keys the way they are shown in the help.
+func keyLabel(keys []string) string {
+	return slice.Join(slice.Map(keys, func(k string, _ int) string {
+		switch k {
+		case "up":
+			return "↑"
+		case "down":
+			return "↓"
+		case " ":
+			return "space"
+		}
+		return k
+	}), "/")
+}
+
+// Builds the keymap from the preset, then the keys configured in the config
+// section, which maps the names of the bindings to comma separated keys.
+func newKeymap(preset string, config map[string]string) (keymap, error) {
+	km := keymap{}
+	overrides, ok := keymapPresets[preset]
+	if !ok {
+		return km, fmt.Errorf("Unknown keymap preset %q, expected default, vim or emacs", preset)
+	}
+
+	for _, def := range keyDefinitions {
+		keys := def.keys
+		if preset_keys, ok := overrides[def.name]; ok {
+			keys = preset_keys
+		}
+		if value, ok := config[strings.ToLower(def.name)]; ok {
+			keys = slice.Filter(
+				slice.Map(strings.Split(value, ","), func(k string, _ int) string { return strings.TrimSpace(k) }),
+				func(k string, _ int) bool { return len(k) > 0 },
+			)
+		}
+		*def.binding(&km) = key.NewBinding(key.WithKeys(keys...), key.WithHelp(keyLabel(keys), def.short))
+	}
+	return km, nil
+}
+
+// Loads the keymap from the `interactive.keymap` preset and the `[keys]`
+// section of the config. If the config is invalid the default keymap is used.
+func loadKeymap() (keymap, error) {
+	preset, ok := getConfig("interactive.keymap")
+	if !ok {
+		preset = "default"
+	}
+	km, err := newKeymap(preset, getConfigSection("keys"))
+	if err != nil {
+		km, _ = newKeymap("default", getConfigSection("keys"))
+	}
+	return km, err
+}
+
+// Lists every binding with its keys, its name in the config and description.
+func (km keymap) helpView() string {
+	labels := slice.Map(keyDefinitions, func(def keyDefinition, _ int) string {
+		return keyLabel(def.binding(&km).Keys())
+	})
+	keyWidth, nameWidth := len("Key"), len("Name")
+	for i, def := range keyDefinitions {
+		keyWidth = max(keyWidth, len([]rune(labels[i])))
+		nameWidth = max(nameWidth, len(def.name))
+	}
+	pad := func(s string, width int) string {
+		return s + strings.Repeat(" ", width-len([]rune(s)))
+	}
+
+	lines := []string{
+		"  " + pad("Key", keyWidth) + " | " + pad("Name", nameWidth) + " | Action",
+		"  " + strings.Repeat("-", keyWidth) + "-|-" + strings.Repeat("-", nameWidth) + "-|-------",
+	}
+	for i, def := range keyDefinitions {
+		if i > 0 && def.scope != keyDefinitions[i-1].scope {
+			lines = append(lines, "", "  "+scopeNames[def.scope])
+		}
+		lines = append(lines, "  "+pad(labels[i], keyWidth)+" | "+pad(def.name, nameWidth)+" | "+def.description)
+	}
+	return "\n" + slice.Join(lines, "\n")
+}
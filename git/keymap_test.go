@@ -0,0 +1,74 @@
+package git
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeymapPresetsHaveNoConflicts(t *testing.T) {
+	// Keys handled by each scope before the bindings are
+	reserved := [SCOPE_COUNT][]string{
+		SCOPE_PANEL:  {"esc", "q"},
+		SCOPE_COMMIT: {"esc", "ctrl+c"},
+	}
+
+	for preset := range keymapPresets {
+		km, err := newKeymap(preset, map[string]string{})
+		assert.NoError(t, err)
+
+		for scope := range SCOPE_COUNT {
+			bound := map[string]string{}
+			for _, k := range reserved[scope] {
+				bound[k] = "reserved"
+			}
+			for _, def := range keyDefinitions {
+				// The panels move with the same keys as the list of repositories
+				shared := scope == SCOPE_PANEL && (def.name == "up" || def.name == "down")
+				if def.scope != scope && !shared {
+					continue
+				}
+				for _, k := range def.binding(&km).Keys() {
+					other, ok := bound[k]
+					assert.False(t, ok, "%s: %q is bound to both %s and %s", preset, k, other, def.name)
+					bound[k] = def.name
+				}
+			}
+		}
+	}
+}
+
+func TestKeymapConfig(t *testing.T) {
+	km, err := newKeymap("vim", map[string]string{"stage": "S, a", "nextmatch": "ctrl+n"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"S", "a"}, km.stage.Keys())
+	assert.Equal(t, []string{"ctrl+n"}, km.nextMatch.Keys())
+	assert.Equal(t, []string{"?"}, km.help.Keys())
+	assert.Equal(t, []string{"u"}, km.unstage.Keys())
+
+	_, err = newKeymap("nano", map[string]string{})
+	assert.Error(t, err)
+}
+
+func TestPanelsUseKeymap(t *testing.T) {
+	km, err := newKeymap("emacs", map[string]string{"choose": "x"})
+	assert.NoError(t, err)
+
+	dir := &directory{path: "repo"}
+	picker := fixupPicker{
+		rows:    []fixupRow{{dir: dir}, {dir: dir, entry: &logEntry{hash: "a"}}, {dir: dir, entry: &logEntry{hash: "b"}}},
+		cursor:  1,
+		targets: map[*directory]string{},
+	}
+	picker.Update(km, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")})
+	assert.Equal(t, 1, picker.cursor)
+	picker.Update(km, tea.KeyMsg{Type: tea.KeyCtrlN})
+	assert.Equal(t, 2, picker.cursor)
+
+	picker.Update(km, tea.KeyMsg{Type: tea.KeySpace, Runes: []rune(" ")})
+	assert.Empty(t, picker.targets)
+	picker.Update(km, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	assert.Equal(t, "b", picker.targets[dir])
+}
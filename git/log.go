@@ -0,0 +1,67 @@
+package git
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Otard95/ngm/lib/slice"
+)
+
+type logEntry struct {
+	hash    string
+	author  string
+	date    time.Time
+	subject string
+	// Branches and tags pointing at the commit, as listed by `%D`
+	refs []string
+}
+
+func (entry logEntry) String() string {
+	return entry.hash + " " + entry.subject
+}
+
+func getLog(dir string, count int) ([]logEntry, error) {
+	out, err := gitOutput(
+		dir, "", nil, "log",
+		"-n", strconv.Itoa(count),
+		"--format=%h%x00%an%x00%at%x00%D%x00%s",
+	)
+	if err != nil {
+		return nil, err
+	}
+	return parseGitLog(&out), nil
+}
+
+// <hash> NUL <author> NUL <unix time> NUL <refs> NUL <subject>
+func parseGitLog(raw *string) []logEntry {
+	lines := slice.Filter(
+		strings.Split(*raw, "\n"),
+		func(l string, _ int) bool { return len(l) > 0 },
+	)
+	return slice.Map(lines, func(l string, _ int) logEntry {
+		fields := strings.SplitN(l, "\x00", 5)
+		for len(fields) < 5 {
+			fields = append(fields, "")
+		}
+
+		entry := logEntry{hash: fields[0], author: fields[1], subject: fields[4]}
+		if seconds, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+			entry.date = time.Unix(seconds, 0)
+		}
+		if len(fields[3]) > 0 {
+			entry.refs = strings.Split(fields[3], ", ")
+		}
+		return entry
+	})
+}
+
+// The changes introduced by the commit. Merge commits are compared to their
+// first parent.
+func getCommitDiff(dir string, hash string) ([]diff, error) {
+	out, err := gitOutput(dir, "", nil, "show", "--format=", "--first-parent", hash)
+	if err != nil {
+		return nil, err
+	}
+	return parseGitDiff(&out), nil
+}
@@ -0,0 +1,40 @@
+package git
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var logRaw = "1a2b3c4\x00Jane Doe\x001700000000\x00HEAD -> main, origin/main, tag: v1.0\x00feat: add log\n" +
+	"5d6e7f8\x00John Doe\x001690000000\x00\x00init\n"
+
+func TestParseGitLog(t *testing.T) {
+	entries := parseGitLog(&logRaw)
+
+	assert.Equal(t, []logEntry{
+		{
+			hash:    "1a2b3c4",
+			author:  "Jane Doe",
+			date:    time.Unix(1700000000, 0),
+			subject: "feat: add log",
+			refs:    []string{"HEAD -> main", "origin/main", "tag: v1.0"},
+		},
+		{hash: "5d6e7f8", author: "John Doe", date: time.Unix(1690000000, 0), subject: "init"},
+	}, entries)
+}
+
+func TestGetLogReadsOnlyStdout(t *testing.T) {
+	dir := commitTestRepository(t)
+	// Makes git write its trace to stderr
+	t.Setenv("GIT_TRACE", "1")
+
+	entries, err := getLog(dir, 10)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "old message", entries[0].subject)
+
+	_, err = getLog(t.TempDir(), 10)
+	assert.ErrorContains(t, err, "not a git repository")
+}
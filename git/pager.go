@@ -0,0 +1,98 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/Otard95/ngm/lib/slice"
+	"github.com/charmbracelet/x/term"
+)
+
+// Resolves the pager the same way git does. Returns an empty string when the
+// output isn't a terminal, or the pager is disabled by setting it to "cat".
+func getPager() string {
+	if !term.IsTerminal(os.Stdout.Fd()) {
+		return ""
+	}
+
+	pager := os.Getenv("GIT_PAGER")
+	if len(pager) == 0 {
+		out, err := exec.Command("git", "config", "--get", "core.pager").Output()
+		if err == nil {
+			pager = strings.TrimSpace(string(out))
+		}
+	}
+	if len(pager) == 0 {
+		pager = os.Getenv("PAGER")
+	}
+	if len(pager) == 0 {
+		pager = "less"
+	}
+	if pager == "cat" {
+		return ""
+	}
+	return pager
+}
+
+// Shows the output in the pager, or prints it if there is none. The pager is
+// run through the shell since it's common for it to contain arguments.
+func page(output string, enabled bool) {
+	pager := ""
+	if enabled {
+		pager = getPager()
+	}
+	if len(pager) == 0 {
+		fmt.Print(output)
+		return
+	}
+
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = strings.NewReader(output)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// Like git, make less keep the colors and quit if it all fits on the screen
+	cmd.Env = os.Environ()
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		cmd.Env = append(cmd.Env, "LESS=FRX")
+	}
+	if _, ok := os.LookupEnv("LV"); !ok {
+		cmd.Env = append(cmd.Env, "LV=-c")
+	}
+
+	err := cmd.Run()
+	// The shell exits with 127 when the pager can't be found
+	var exit_err *exec.ExitError
+	if err != nil && (!errors.As(err, &exit_err) || exit_err.ExitCode() == 127) {
+		fmt.Print(output)
+	}
+}
+
+// Pipes the patch through the command, like delta, returning what it prints.
+// The command is told the width of the terminal since it's not writing to it.
+func filterDiff(command string, patch string, width int) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = strings.NewReader(patch)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("COLUMNS=%d", width))
+	out, err := cmd.Output()
+	var exit_err *exec.ExitError
+	if errors.As(err, &exit_err) {
+		return string(out), commandError(exit_err.Stderr, err)
+	}
+	return string(out), err
+}
+
+// Has git run the command for each changed file, like difftastic, returning
+// what it prints.
+func externalDiff(dir string, command string, options DiffOptions, width int) (string, error) {
+	cmd := exec.Command("git", slice.Concat([]string{"-C", dir, "diff", "--ext-diff"}, options.args())...)
+	cmd.Env = append(os.Environ(), "GIT_EXTERNAL_DIFF="+command, fmt.Sprintf("COLUMNS=%d", width))
+	out, err := cmd.Output()
+	var exit_err *exec.ExitError
+	if errors.As(err, &exit_err) {
+		return string(out), commandError(exit_err.Stderr, err)
+	}
+	return string(out), err
+}
@@ -16,11 +16,7 @@ func Pull(userArgs []string) {
 			Name:  dir,
 			State: ui.NotStarted,
 			Run: func() (string, error) {
-				args := slice.Concat([]string{"-C", dir, "pull"}, userArgs)
-				cmd := exec.Command("git", args...)
-				out, err := cmd.CombinedOutput()
-				out_str := string(out)
-				return out_str, err
+				return doPull(dir, userArgs)
 			},
 		}
 	})
@@ -36,3 +32,11 @@ func Pull(userArgs []string) {
 		}
 	}
 }
+
+func doPull(dir string, userArgs []string) (string, error) {
+	args := slice.Concat([]string{"-C", dir, "pull"}, userArgs)
+	cmd := exec.Command("git", args...)
+	out, err := cmd.CombinedOutput()
+	out_str := string(out)
+	return out_str, err
+}
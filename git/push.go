@@ -16,11 +16,7 @@ func Push(userArgs []string) {
 			Name:  dir,
 			State: ui.NotStarted,
 			Run: func() (string, error) {
-				args := slice.Concat([]string{"-C", dir, "push"}, userArgs)
-				cmd := exec.Command("git", args...)
-				out, err := cmd.CombinedOutput()
-				out_str := string(out)
-				return out_str, err
+				return doPush(dir, userArgs)
 			},
 		}
 	})
@@ -36,3 +32,11 @@ func Push(userArgs []string) {
 		}
 	}
 }
+
+func doPush(dir string, userArgs []string) (string, error) {
+	args := slice.Concat([]string{"-C", dir, "push"}, userArgs)
+	cmd := exec.Command("git", args...)
+	out, err := cmd.CombinedOutput()
+	out_str := string(out)
+	return out_str, err
+}
@@ -0,0 +1,267 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/Otard95/ngm/ui"
+	"github.com/alecthomas/chroma/v2"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+var (
+	diffAddWord    = lipgloss.NewStyle().Foreground(ui.ColorBase).Background(ui.ColorGreen)
+	diffRemoveWord = lipgloss.NewStyle().Foreground(ui.ColorBase).Background(ui.ColorRed)
+)
+
+// Above this many token comparisons a pair of lines is too different, or too
+// long, to be worth highlighting word by word.
+const wordDiffLimit = 250_000
+
+type sideKind int
+
+const (
+	SIDE_EMPTY sideKind = iota
+	SIDE_CONTEXT
+	SIDE_REMOVED
+	SIDE_ADDED
+)
+
+// A part of a line, changed when it's not on the other side of the pair.
+type segment struct {
+	text    string
+	changed bool
+	// The syntax of the text, when it's highlighted
+	highlighted bool
+	token       chroma.TokenType
+}
+
+type side struct {
+	kind sideKind
+	// The number of the line in its version of the file, 0 for empty sides
+	number   int
+	segments []segment
+}
+
+// A row of a side by side diff, either a pair of lines or a header like the
+// "@@ … @@" line starting a hunk.
+type sideRow struct {
+	header      string
+	isHeader    bool
+	left, right side
+	// The width of the line numbers before each side
+	gutter int
+}
+
+// Lines up the removed lines of the hunks with the added lines following them,
+// highlighting the words that changed between each pair.
+func pairHunks(hunks []hunk) []sideRow {
+	rows := []sideRow{}
+	gutter := gutterWidth(hunks)
+	removed, added := []hunkLine{}, []hunkLine{}
+	flush := func() {
+		for i := 0; i < max(len(removed), len(added)); i++ {
+			row := sideRow{gutter: gutter}
+			switch {
+			case i < len(removed) && i < len(added):
+				left, right := wordDiff(removed[i].text, added[i].text)
+				row.left = side{kind: SIDE_REMOVED, number: removed[i].oldLine, segments: left}
+				row.right = side{kind: SIDE_ADDED, number: added[i].newLine, segments: right}
+			case i < len(removed):
+				row.left = side{kind: SIDE_REMOVED, number: removed[i].oldLine, segments: []segment{{text: removed[i].text}}}
+			default:
+				row.right = side{kind: SIDE_ADDED, number: added[i].newLine, segments: []segment{{text: added[i].text}}}
+			}
+			rows = append(rows, row)
+		}
+		removed, added = []hunkLine{}, []hunkLine{}
+	}
+
+	for _, h := range hunks {
+		flush()
+		rows = append(rows, sideRow{header: h.header, isHeader: true, gutter: gutter})
+		for _, l := range h.lines {
+			switch l.kind {
+			case HUNK_REMOVED:
+				// A removal after additions starts a new change
+				if len(added) > 0 {
+					flush()
+				}
+				removed = append(removed, l)
+			case HUNK_ADDED:
+				added = append(added, l)
+			case HUNK_CONTEXT:
+				flush()
+				rows = append(rows, sideRow{
+					left:   side{kind: SIDE_CONTEXT, number: l.oldLine, segments: []segment{{text: l.text}}},
+					right:  side{kind: SIDE_CONTEXT, number: l.newLine, segments: []segment{{text: l.text}}},
+					gutter: gutter,
+				})
+			default:
+				flush()
+				rows = append(rows, sideRow{header: l.text, isHeader: true, gutter: gutter})
+			}
+		}
+	}
+	flush()
+	return rows
+}
+
+// Splits a line into words, runs of whitespace and single other characters.
+func tokenize(s string) []string {
+	tokens := []string{}
+	class := func(r rune) int {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			return 1
+		case unicode.IsSpace(r):
+			return 2
+		}
+		return 0
+	}
+
+	start := 0
+	runes := []rune(s)
+	for i := 1; i <= len(runes); i++ {
+		if i == len(runes) || class(runes[i]) == 0 || class(runes[i]) != class(runes[start]) {
+			tokens = append(tokens, string(runes[start:i]))
+			start = i
+		}
+	}
+	return tokens
+}
+
+// Compares the tokens of two lines, marking the ones that aren't in both. Lines
+// with nothing in common are left unmarked since all of it changed anyway.
+func wordDiff(a, b string) ([]segment, []segment) {
+	unchanged := func() ([]segment, []segment) {
+		return []segment{{text: a}}, []segment{{text: b}}
+	}
+	as, bs := tokenize(a), tokenize(b)
+	if len(as)*len(bs) > wordDiffLimit {
+		return unchanged()
+	}
+
+	// The length of the longest common subsequence of as[i:] and bs[j:]
+	lcs := make([][]int, len(as)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bs)+1)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			if as[i] == bs[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	if lcs[0][0] == 0 {
+		return unchanged()
+	}
+
+	left, right := []segment{}, []segment{}
+	add := func(segments []segment, text string, changed bool) []segment {
+		if n := len(segments); n > 0 && segments[n-1].changed == changed {
+			segments[n-1].text += text
+			return segments
+		}
+		return append(segments, segment{text: text, changed: changed})
+	}
+	i, j := 0, 0
+	for i < len(as) || j < len(bs) {
+		switch {
+		case i < len(as) && j < len(bs) && as[i] == bs[j]:
+			left = add(left, as[i], false)
+			right = add(right, bs[j], false)
+			i, j = i+1, j+1
+		case j == len(bs) || (i < len(as) && lcs[i+1][j] >= lcs[i][j+1]):
+			left = add(left, as[i], true)
+			i++
+		default:
+			right = add(right, bs[j], true)
+			j++
+		}
+	}
+	return left, right
+}
+
+// Cuts the text to fit the width, ending it with "…" if anything was cut.
+// Returns the cut text, its width and whether anything was cut.
+func truncate(text string, width int) (string, int, bool) {
+	text = strings.ReplaceAll(text, "\t", "    ")
+	if runewidth.StringWidth(text) <= width {
+		return text, runewidth.StringWidth(text), false
+	}
+	if width <= 0 {
+		return "", 0, true
+	}
+	cut := runewidth.Truncate(text, width, "…")
+	return cut, runewidth.StringWidth(cut), true
+}
+
+// Renders the side padded to exactly the width, after its line number in a
+// gutter of the given width.
+func (s side) render(width int, gutter int) string {
+	number := strings.Repeat(" ", gutter)
+	if s.number > 0 {
+		number = fmt.Sprintf("%*d", gutter, s.number)
+	}
+	prefix := diffGutter.Render(number + " ")
+	width -= gutter + 1
+
+	style, word_style, background := diffUnchanged, diffUnchanged, lipgloss.NewStyle()
+	switch s.kind {
+	case SIDE_REMOVED:
+		style, word_style, background = diffRemove, diffRemoveWord, diffRemoveBackground
+	case SIDE_ADDED:
+		style, word_style, background = diffAdd, diffAddWord, diffAddBackground
+	}
+
+	text, used := "", 0
+	for _, seg := range s.segments {
+		cut, w, truncated := truncate(seg.text, width-used)
+		switch {
+		case seg.changed:
+			text += word_style.Render(cut)
+		case seg.highlighted:
+			text += tokenStyle(seg.token, background).Render(cut)
+		default:
+			text += style.Render(cut)
+		}
+		used += w
+		if truncated {
+			break
+		}
+	}
+	return prefix + text + strings.Repeat(" ", max(width-used, 0))
+}
+
+// Renders the row in the width, split evenly between the two sides.
+func (row sideRow) Render(width int) string {
+	if row.isHeader {
+		text, _, _ := truncate(row.header, width-row.gutter-1)
+		return strings.Repeat(" ", row.gutter+1) + diffHeader.Render(text)
+	}
+	sideWidth := max((width-3)/2, 10)
+	return row.left.render(sideWidth, row.gutter) + diffUnchanged.Render(" │ ") + row.right.render(sideWidth, row.gutter)
+}
+
+// Like String, but with the removed and added lines next to each other.
+func (diff diff) SideBySide(width int, highlight bool) string {
+	if summary := diff.Summary(); len(summary) > 0 {
+		return diff.titleBox() + "\n" + diffUnchanged.Render(summary)
+	}
+
+	rows := pairHunks(diff.hunks)
+	if highlight {
+		highlightRows(diff.File(), rows)
+	}
+	lines := []string{diff.titleBox()}
+	for _, row := range rows {
+		lines = append(lines, strings.TrimRight(row.Render(width), " "))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,50 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPairHunks(t *testing.T) {
+	h, _ := parseHunk([]string{
+		"@@ -8,4 +8,4 @@",
+		" context",
+		"-old line",
+		"-removed",
+		"+new line",
+		" end",
+		"+added",
+	})
+	rows := pairHunks([]hunk{h})
+
+	context := func(text string, old, new int) sideRow {
+		return sideRow{
+			left:   side{kind: SIDE_CONTEXT, number: old, segments: []segment{{text: text}}},
+			right:  side{kind: SIDE_CONTEXT, number: new, segments: []segment{{text: text}}},
+			gutter: 2,
+		}
+	}
+	assert.Equal(t, []sideRow{
+		{header: "@@ -8,4 +8,4 @@", isHeader: true, gutter: 2},
+		context("context", 8, 8),
+		{
+			left:   side{kind: SIDE_REMOVED, number: 9, segments: []segment{{text: "old", changed: true}, {text: " line"}}},
+			right:  side{kind: SIDE_ADDED, number: 9, segments: []segment{{text: "new", changed: true}, {text: " line"}}},
+			gutter: 2,
+		},
+		{left: side{kind: SIDE_REMOVED, number: 10, segments: []segment{{text: "removed"}}}, gutter: 2},
+		context("end", 11, 10),
+		{right: side{kind: SIDE_ADDED, number: 11, segments: []segment{{text: "added"}}}, gutter: 2},
+	}, rows)
+}
+
+func TestWordDiff(t *testing.T) {
+	left, right := wordDiff("foo(a, b)", "foo(a, c, b)")
+	assert.Equal(t, []segment{{text: "foo(a, b)"}}, left)
+	assert.Equal(t, []segment{{text: "foo(a, "}, {text: "c, ", changed: true}, {text: "b)"}}, right)
+
+	left, right = wordDiff("abc", "xyz")
+	assert.Equal(t, []segment{{text: "abc"}}, left)
+	assert.Equal(t, []segment{{text: "xyz"}}, right)
+}
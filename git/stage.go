@@ -1,26 +1,71 @@
 package git
 
-import "os/exec"
+import (
+	"os/exec"
 
-func stageChange(dir string, change change) error {
-	sub_cmd := "add"
-	if change.kind == DELETED {
-		sub_cmd = "rm"
+	"github.com/Otard95/ngm/lib/slice"
+)
+
+// A set of files in a repository, grouped by their state.
+type fileSet struct {
+	untracked []string
+	unstaged  []change
+	staged    []change
+	unmerged  []unmergedChange
+}
+
+func (files fileSet) Count() int {
+	return len(files.untracked) + len(files.unstaged) + len(files.staged) + len(files.unmerged)
+}
+
+// The paths of the changes, including the original path of renames so both
+// sides of the rename are affected.
+func changePaths(changes []change) []string {
+	paths := []string{}
+	for _, c := range changes {
+		paths = append(paths, c.file)
+		if c.orig_file != nil {
+			paths = append(paths, *c.orig_file)
+		}
 	}
+	return paths
+}
 
-	cmd := exec.Command("git", "-C", dir, sub_cmd, change.file)
-	_, err := cmd.CombinedOutput()
-	return err
+func runStageCommand(dir string, args []string, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	cmd := exec.Command("git", slice.Concat([]string{"-C", dir}, args, []string{"--"}, paths)...)
+	out, err := cmd.CombinedOutput()
+	return commandError(out, err)
+}
+
+// Stages the untracked, unstaged and unmerged files. Staging an unmerged file
+// marks its conflict as resolved.
+func stageFiles(dir string, files fileSet) error {
+	paths := slice.Concat(
+		files.untracked,
+		changePaths(files.unstaged),
+		slice.Map(files.unmerged, func(c unmergedChange, _ int) string { return c.file }),
+	)
+	return runStageCommand(dir, []string{"add", "-A"}, paths)
 }
 
-func stagePath(dir string, path string) error {
-	cmd := exec.Command("git", "-C", dir, "add", path)
-	_, err := cmd.CombinedOutput()
-	return err
+func unstageFiles(dir string, files fileSet) error {
+	return runStageCommand(dir, []string{"reset", "-q", "HEAD"}, changePaths(files.staged))
 }
 
-func unstageChange(dir string, change change) error {
-	cmd := exec.Command("git", "-C", dir, "reset", "HEAD", change.file)
-	_, err := cmd.CombinedOutput()
-	return err
+// Throws away the changes to the files. Staged files are restored to HEAD,
+// unstaged files to the index and untracked files are removed. Unmerged files
+// are left alone.
+func discardFiles(dir string, files fileSet) error {
+	err := runStageCommand(dir, []string{"restore", "--staged", "--worktree", "--source=HEAD"}, changePaths(files.staged))
+	if err != nil {
+		return err
+	}
+	err = runStageCommand(dir, []string{"restore"}, changePaths(files.unstaged))
+	if err != nil {
+		return err
+	}
+	return runStageCommand(dir, []string{"clean", "-fdq"}, files.untracked)
 }
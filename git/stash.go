@@ -0,0 +1,71 @@
+package git
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/Otard95/ngm/lib/slice"
+)
+
+type stashEntry struct {
+	// The reflog selector, like `stash@{0}`
+	ref     string
+	subject string
+}
+
+func (entry stashEntry) String() string {
+	return entry.ref + " " + entry.subject
+}
+
+func getStashes(dir string) ([]stashEntry, error) {
+	out, err := gitOutput(dir, "", nil, "stash", "list", "--format=%gd%x00%gs")
+	if err != nil {
+		return nil, err
+	}
+	return parseStashes(&out), nil
+}
+
+// <ref> NUL <subject>
+func parseStashes(raw *string) []stashEntry {
+	lines := slice.Filter(
+		strings.Split(*raw, "\n"),
+		func(l string, _ int) bool { return len(l) > 0 },
+	)
+	return slice.Map(lines, func(l string, _ int) stashEntry {
+		ref, subject, _ := strings.Cut(l, "\x00")
+		return stashEntry{ref: ref, subject: subject}
+	})
+}
+
+func getStashDiff(dir string, ref string) ([]diff, error) {
+	out, err := gitOutput(dir, "", nil, "stash", "show", "-p", ref)
+	if err != nil {
+		return nil, err
+	}
+	return parseGitDiff(&out), nil
+}
+
+func runStashCommand(dir string, args ...string) error {
+	cmd := exec.Command("git", slice.Concat([]string{"-C", dir, "stash"}, args)...)
+	out, err := cmd.CombinedOutput()
+	return commandError(out, err)
+}
+
+func doStash(dir string, message string) error {
+	if len(message) == 0 {
+		return runStashCommand(dir, "push")
+	}
+	return runStashCommand(dir, "push", "-m", message)
+}
+
+func doStashApply(dir string, ref string) error {
+	return runStashCommand(dir, "apply", ref)
+}
+
+func doStashPop(dir string, ref string) error {
+	return runStashCommand(dir, "pop", ref)
+}
+
+func doStashDrop(dir string, ref string) error {
+	return runStashCommand(dir, "drop", ref)
+}
@@ -1,10 +1,15 @@
 package git
 
 import (
+	"cmp"
 	"fmt"
+	"io/fs"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/Otard95/ngm/lib/slice"
 	sv "github.com/Otard95/ngm/lib/string-view"
@@ -16,6 +21,7 @@ var (
 	staged_style    = lipgloss.NewStyle().Foreground(ui.ColorGreen)
 	unstaged_style  = lipgloss.NewStyle().Foreground(ui.ColorRed)
 	untracked_style = lipgloss.NewStyle().Foreground(ui.ColorMaroon)
+	ignored_style   = lipgloss.NewStyle().Foreground(ui.ColorOverlay1)
 	branch_icon     = lipgloss.NewStyle().Foreground(ui.ColorMauve)
 )
 
@@ -33,6 +39,7 @@ const (
 )
 
 var changeKindIcon = [CHANGE_KIND_COUNT]string{"󱇨 ", " ", "󱀷 ", "󱀱 ", "󰆏 ", "󱁼 ", " "}
+var changeKindName = [CHANGE_KIND_COUNT]string{"modified", "new file", "deleted", "renamed", "copied", "typechange", "unmerged"}
 
 func changeKindFromString(s string) changeKind {
 	switch s {
@@ -56,11 +63,61 @@ func changeKindFromString(s string) changeKind {
 func (c changeKind) Icon() string {
 	return changeKindIcon[c]
 }
+func (c changeKind) String() string {
+	return changeKindName[c]
+}
+
+const submodule_icon = "󰊢 "
+
+// The state of a submodule, read from the <sub> field "S<c><m><u>" of a change.
+type submoduleState struct {
+	// Checked out at another commit than the one recorded in the repository
+	commitChanged bool
+	// Has changes to tracked files
+	modified bool
+	// Has untracked files
+	untracked bool
+}
+
+// Parses the <sub> field, returning nil for changes to anything but submodules,
+// or false if it's not a state git lists.
+func parseSubmoduleState(field string) (*submoduleState, bool) {
+	if field == "N..." {
+		return nil, true
+	}
+	if len(field) != 4 || field[0] != 'S' ||
+		!strings.Contains("C.", field[1:2]) || !strings.Contains("M.", field[2:3]) || !strings.Contains("U.", field[3:]) {
+		return nil, false
+	}
+	return &submoduleState{
+		commitChanged: field[1] == 'C',
+		modified:      field[2] == 'M',
+		untracked:     field[3] == 'U',
+	}, true
+}
+
+// Describes the state like `git status` does, like "new commits, modified
+// content".
+func (s submoduleState) String() string {
+	states := []string{}
+	if s.commitChanged {
+		states = append(states, "new commits")
+	}
+	if s.modified {
+		states = append(states, "modified content")
+	}
+	if s.untracked {
+		states = append(states, "untracked content")
+	}
+	return slice.Join(states, ", ")
+}
 
 type change struct {
 	kind      changeKind
 	file      string
 	orig_file *string
+	// The state of the submodule, nil if it's not a submodule
+	sub *submoduleState
 }
 
 func (c change) String() string {
@@ -68,12 +125,20 @@ func (c change) String() string {
 	if c.orig_file != nil {
 		out += " → " + *c.orig_file
 	}
+	if c.sub != nil {
+		out += " " + submodule_icon
+		if state := c.sub.String(); len(state) > 0 {
+			out += "(" + state + ")"
+		}
+	}
 	return out
 }
 
 type unmergedChange struct {
 	kind [2]changeKind
 	file string
+	// The state of the submodule, nil if it's not a submodule
+	sub *submoduleState
 }
 
 func (c unmergedChange) String() string {
@@ -108,6 +173,9 @@ func (c unmergedChange) String() string {
 	}
 
 	out += " " + c.file
+	if c.sub != nil {
+		out += " " + submodule_icon
+	}
 	return out
 }
 
@@ -127,6 +195,18 @@ type status struct {
 	unstaged  []change
 	unmerged  []unmergedChange
 	untracked []string
+	// Only read when asked for, since git has to look through build directories
+	// and the like to find them
+	ignored []string
+	// The number of entries in the stash
+	stashCount int
+}
+
+func (s *status) IsClean() bool {
+	return len(s.staged) == 0 &&
+		len(s.unstaged) == 0 &&
+		len(s.unmerged) == 0 &&
+		len(s.untracked) == 0
 }
 
 func (s *status) PrintBranchInfo() string {
@@ -134,21 +214,33 @@ func (s *status) PrintBranchInfo() string {
 	if s.branch.upstream != nil {
 		out += fmt.Sprintf(" ↑%d ↓%d", s.branch.upstream.ahead, s.branch.upstream.behind)
 	}
+	if s.stashCount > 0 {
+		out += fmt.Sprintf(" %s %d", branch_icon.Render("󰏗"), s.stashCount)
+	}
 	return out
 }
 
 func (s *status) Glance() string {
 	changeKinds := []changeKind{}
+	submodules := false
 	for _, c := range s.staged {
 		changeKinds = append(changeKinds, c.kind)
+		submodules = submodules || c.sub != nil
 	}
 	for _, c := range s.unstaged {
 		changeKinds = append(changeKinds, c.kind)
+		submodules = submodules || c.sub != nil
 	}
 	icons := slice.Map(
 		slices.Compact(changeKinds),
 		func(c changeKind, _ int) string { return c.Icon() },
 	)
+	if submodules {
+		icons = append(icons, submodule_icon)
+	}
+	if len(s.unmerged) > 0 {
+		icons = append(icons, UNMERGED.Icon())
+	}
 	if len(s.untracked) > 0 {
 		icons = append(icons, " ")
 	}
@@ -195,18 +287,54 @@ func (s *status) Print() string {
 			"\n",
 		) + "\n"
 	}
+	if len(s.ignored) > 0 {
+		out += "  Ignored:\n"
+		out += slice.Join(
+			slice.Map(s.ignored, func(i string, _ int) string {
+				return "    " + ignored_style.Render(" "+i)
+			}),
+			"\n",
+		) + "\n"
+	}
 
 	return out
 }
 
-func Status() {
+type StatusOptions struct {
+	// Include the ignored files
+	Ignored bool
+	// Only report how much space the ignored files of each repository take
+	IgnoredSize bool
+	// Include the submodules of each repository as nested repositories
+	RecurseSubmodules bool
+	// Don't refresh the index while reading the status, for reads in the
+	// background that shouldn't lock it or be picked up by the file watcher
+	noOptionalLocks bool
+}
+
+func (options StatusOptions) args() []string {
+	args := []string{"status", "--porcelain=v2", "-z", "-b", "--show-stash"}
+	if options.Ignored || options.IgnoredSize {
+		args = append(args, "--ignored")
+	}
+	return args
+}
+
+func Status(options StatusOptions) {
 	dirs := getDirectories(false)
+	if options.RecurseSubmodules || getConfigBool("submodules.recurse") {
+		dirs = withSubmodules(dirs)
+	}
+	if options.IgnoredSize {
+		statusIgnoredSize(dirs)
+		return
+	}
 
 	tasks := slice.Map(dirs, func(dir string, _ int) ui.Task[*status] {
 		return ui.Task[*status]{
 			Name: dir,
 			Run: func() (*status, error) {
-				return getStatus(dir)
+				return getStatus(dir, options)
 			},
 		}
 	})
@@ -223,174 +351,301 @@ func Status() {
 	}
 }
 
-func getStatus(dir string) (*status, error) {
-	cmd := exec.Command("git", "-C", dir, "status", "--porcelain=v2", "-b")
-	out, err := cmd.CombinedOutput()
-	out_str := string(out)
+// The number of ignored files in a repository and their total size in bytes.
+type ignoredUsage struct {
+	files int
+	size  int64
+}
+
+// Adds up the size of the ignored entries of the repository, including all the
+// files in ignored directories. Nested repositories are left out, both the
+// other repositories of the workspace, which are counted on their own, and any
+// other directory with a .git in it.
+func getIgnoredUsage(dir string, entries []string, others []string) ignoredUsage {
+	skip := map[string]bool{}
+	for _, other := range others {
+		skip[filepath.Clean(other)] = true
+	}
+
+	usage := ignoredUsage{}
+	for _, entry := range entries {
+		// Files may disappear or be unreadable, like in the middle of a build, so
+		// they're skipped rather than failing the whole repository
+		filepath.WalkDir(filepath.Join(dir, entry), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if skip[filepath.Clean(path)] {
+					return filepath.SkipDir
+				}
+				// A .git file for worktrees and submodules
+				if _, err := os.Lstat(filepath.Join(path, ".git")); err == nil {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				usage.files++
+				usage.size += info.Size()
+			}
+			return nil
+		})
+	}
+	return usage
+}
+
+// Formats the number of bytes in the largest binary unit it has at least one of.
+func formatSize(bytes int64) string {
+	if bytes < 1024 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(1024), 0
+	for n := bytes / 1024; n >= 1024; n /= 1024 {
+		div *= 1024
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// Lists the repositories by how much space their ignored files take, largest
+// first, to find the build artefacts bloating the workspace.
+func statusIgnoredSize(dirs []string) {
+	tasks := slice.Map(dirs, func(dir string, _ int) ui.Task[ignoredUsage] {
+		return ui.Task[ignoredUsage]{
+			Name: dir,
+			Run: func() (ignoredUsage, error) {
+				statuz, err := getStatus(dir, StatusOptions{Ignored: true})
+				if err != nil {
+					return ignoredUsage{}, err
+				}
+				return getIgnoredUsage(dir, statuz.ignored, dirs), nil
+			},
+		}
+	})
+
+	results := ui.DisplayParallelProgress(tasks)
+
+	usages := make([]ignoredUsage, len(dirs))
+	order, width := []int{}, 0
+	for i, dir := range dirs {
+		usage, err := results[i].Unwrap()
+		if err != nil {
+			fmt.Printf(" %s %s\n%v\n", ui.ErrorStyle.Render("⨯"), dir, err)
+			continue
+		}
+		usages[i] = usage
+		order = append(order, i)
+		width = max(width, len(dir))
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(usages[b].size, usages[a].size)
+	})
+
+	files := func(n int) string {
+		if n == 1 {
+			return "1 file"
+		}
+		return fmt.Sprintf("%d files", n)
+	}
+	total := ignoredUsage{}
+	for _, i := range order {
+		fmt.Printf(
+			" %s %s%s %10s in %s\n",
+			ui.SuccessStyle.Render("✔"), dirs[i], strings.Repeat(" ", width-len(dirs[i])),
+			formatSize(usages[i].size), files(usages[i].files),
+		)
+		total.files += usages[i].files
+		total.size += usages[i].size
+	}
+	fmt.Printf("\n Total: %s in %s in %d of %d repositories\n", formatSize(total.size), files(total.files), len(order), len(dirs))
+}
+
+func getStatus(dir string, options StatusOptions) (*status, error) {
+	cmd := exec.Command("git", slice.Concat([]string{"-C", dir}, options.args())...)
+	if options.noOptionalLocks {
+		cmd.Env = append(os.Environ(), "GIT_OPTIONAL_LOCKS=0")
+	}
+	out, err := commandOutput(cmd, nil)
 	if err != nil {
 		return nil, err
 	}
-	return parseGitStatus(&out_str), nil
+	return parseGitStatus(&out), nil
 }
 
+// Parses the output of `git status --porcelain=v2 -z`. Each entry ends with a
+// NUL and paths are never quoted, so they're read as is up to the end of the
+// entry. The original path of a rename or copy is the entry following it.
 func parseGitStatus(raw *string) *status {
 	var statuz status
 	var view = sv.New(raw)
 
-	view.Seek(sv.Not(sv.Whitespace()))
-
 	for view.Length() > 0 {
-		line_type := view.TakeUntil(sv.Whitespace())
+		entry := takeEntry(view)
+		line_type := takeField(entry)
 
 		switch line_type.String() {
 		case "#":
-			parseHeader(&statuz, view.TakeLine())
+			parseHeader(&statuz, entry)
 		case "1":
-			parseOrdinaryChange(&statuz, view.TakeLine())
+			parseOrdinaryChange(&statuz, entry)
 		case "2":
-			parseRenameOrCopyChange(&statuz, view.TakeLine())
+			parseRenameOrCopyChange(&statuz, entry, takeEntry(view))
 		case "u":
-			parseUnmergedChange(&statuz, view.TakeLine())
+			parseUnmergedChange(&statuz, entry)
 		case "?":
-			view.SeekEndOf(sv.Whitespace())
-			statuz.untracked = append(statuz.untracked, view.TakeLine().String())
-		default:
-			view.TakeLine()
+			statuz.untracked = append(statuz.untracked, entry.String())
+		case "!":
+			statuz.ignored = append(statuz.ignored, entry.String())
 		}
-
-		view.Seek(sv.Not(sv.Whitespace()))
 	}
 
 	return &statuz
 }
 
+// Takes the entry up to the next NUL, skipping the NUL.
+func takeEntry(view *sv.StringView) *sv.StringView {
+	entry := view.TakeUntil(sv.String("\x00"))
+	view.Take(1)
+	return entry
+}
+
+// Takes the field up to the next space, skipping the space. Only one space is
+// skipped since paths may start with spaces.
+func takeField(view *sv.StringView) *sv.StringView {
+	field := view.TakeUntil(sv.String(" "))
+	view.Take(1)
+	return field
+}
+
+// Splits the <XY> field into the index and working tree status, or returns
+// false if they're not kinds of changes git lists.
+func parseXY(view *sv.StringView) (string, string, bool) {
+	xy := takeField(view).String()
+	if len(xy) != 2 || !strings.Contains(".MTADRCU", xy[:1]) || !strings.Contains(".MTADRCU", xy[1:]) {
+		return "", "", false
+	}
+	return xy[:1], xy[1:], true
+}
+
 func parseHeader(statuz *status, view *sv.StringView) {
-	view.SeekEndOf(sv.String("."))
-	branch_line_type := view.SplitOnNext(sv.Whitespace())
-
-	switch branch_line_type.String() {
-	case "oid":
-		commit := view.TakeUntil(sv.Whitespace())
-		statuz.branch.commit = commit.String()
-	case "head":
-		branch := view.TakeUntil(sv.Whitespace())
-		statuz.branch.name = branch.String()
-	case "upstream":
-		us := view.TakeUntil(sv.Whitespace())
+	switch takeField(view).String() {
+	case "stash":
+		statuz.stashCount, _ = strconv.Atoi(view.String())
+	case "branch.oid":
+		statuz.branch.commit = view.String()
+	case "branch.head":
+		statuz.branch.name = view.String()
+	case "branch.upstream":
 		if statuz.branch.upstream == nil {
 			statuz.branch.upstream = &upstream{ahead: 0, behind: 0, ref: ""}
 		}
-		statuz.branch.upstream.ref = us.String()
-	case "ab":
+		statuz.branch.upstream.ref = view.String()
+	case "branch.ab":
 		if statuz.branch.upstream == nil {
 			statuz.branch.upstream = &upstream{ahead: 0, behind: 0, ref: ""}
 		}
-		ahead_sv := view.SplitOnNext(sv.Whitespace())
+		ahead_sv := takeField(view)
 		ahead_sv.Seek(sv.Digit())
-		ahead, _ := strconv.Atoi(ahead_sv.String())
-		statuz.branch.upstream.ahead = ahead
+		statuz.branch.upstream.ahead, _ = strconv.Atoi(ahead_sv.String())
 
 		view.Seek(sv.Digit())
-		behind, _ := strconv.Atoi(view.String())
-		statuz.branch.upstream.behind = behind
+		statuz.branch.upstream.behind, _ = strconv.Atoi(view.String())
 	}
 }
 
 // 1 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <path>
 func parseOrdinaryChange(statuz *status, view *sv.StringView) {
-	view.SeekEndOf(sv.Whitespace())
-	index := view.Take(1).String()
-	working_tree := view.Take(1).String()
+	index, working_tree, ok := parseXY(view)
+	if !ok {
+		return
+	}
 
-	view.Seek(sv.Letter())
-	if view.Take(1).String() != "N" { // for now we don't worry about submodules
+	sub, ok := parseSubmoduleState(takeField(view).String())
+	if !ok {
 		return
 	}
 
-	view.SeekNext(sv.Whitespace()). // Skip <sub>
-					SeekNext(sv.Whitespace()). // Skip <mH>
-					SeekNext(sv.Whitespace()). // Skip <mI>
-					SeekNext(sv.Whitespace()). // Skip <mW>
-					SeekNext(sv.Whitespace()). // Skip <hH>
-					SeekNext(sv.Whitespace()). // Skip <hI>
-					SeekNext(sv.Letter())
+	takeField(view) // Skip <mH>
+	takeField(view) // Skip <mI>
+	takeField(view) // Skip <mW>
+	takeField(view) // Skip <hH>
+	takeField(view) // Skip <hI>
 
-	path := view.TakeLine().String()
+	path := view.String()
 
 	if index != "." {
 		statuz.staged = append(
 			statuz.staged,
-			change{kind: changeKindFromString(index), file: path},
+			change{kind: changeKindFromString(index), file: path, sub: sub},
 		)
 	}
 	if working_tree != "." {
 		statuz.unstaged = append(
 			statuz.unstaged,
-			change{kind: changeKindFromString(working_tree), file: path},
+			change{kind: changeKindFromString(working_tree), file: path, sub: sub},
 		)
 	}
 }
 
-// 2 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <X><score> <path><sep><origPath>
-func parseRenameOrCopyChange(statuz *status, view *sv.StringView) {
-	view.SeekEndOf(sv.Whitespace())
-	index := view.Take(1).String()
-	working_tree := view.Take(1).String()
+// 2 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <X><score> <path>NUL<origPath>
+func parseRenameOrCopyChange(statuz *status, view *sv.StringView, orig *sv.StringView) {
+	index, working_tree, ok := parseXY(view)
+	if !ok {
+		return
+	}
 
-	view.Seek(sv.Letter())
-	if view.Take(1).String() != "N" { // for now we don't worry about submodules
+	sub, ok := parseSubmoduleState(takeField(view).String())
+	if !ok {
 		return
 	}
 
-	view.SeekNext(sv.Whitespace()). // Skip <sub>
-					SeekNext(sv.Whitespace()). // Skip <mH>
-					SeekNext(sv.Whitespace()). // Skip <mI>
-					SeekNext(sv.Whitespace()). // Skip <mW>
-					SeekNext(sv.Whitespace()). // Skip <hH>
-					SeekNext(sv.Whitespace()). // Skip <hI>
-					SeekNext(sv.Whitespace()). // Skip <X><score>
-					SeekNext(sv.Letter())
+	takeField(view) // Skip <mH>
+	takeField(view) // Skip <mI>
+	takeField(view) // Skip <mW>
+	takeField(view) // Skip <hH>
+	takeField(view) // Skip <hI>
+	takeField(view) // Skip <X><score>
 
-	path := view.TakeUntil(sv.Whitespace()).String()
-	view.Seek(sv.Not(sv.Whitespace()))
-	orig_path := view.TakeLine().String()
+	path := view.String()
+	orig_path := orig.String()
 
 	if index != "." {
 		statuz.staged = append(
 			statuz.staged,
-			change{kind: changeKindFromString(index), file: path, orig_file: &orig_path},
+			change{kind: changeKindFromString(index), file: path, orig_file: &orig_path, sub: sub},
 		)
 	}
 	if working_tree != "." {
 		statuz.unstaged = append(
 			statuz.unstaged,
-			change{kind: changeKindFromString(working_tree), file: path, orig_file: &orig_path},
+			change{kind: changeKindFromString(working_tree), file: path, orig_file: &orig_path, sub: sub},
 		)
 	}
 }
 
 // u <XY> <sub> <m1> <m2> <m3> <mW> <h1> <h2> <h3> <path>
 func parseUnmergedChange(statuz *status, view *sv.StringView) {
-	view.SeekEndOf(sv.Whitespace())
-	index := view.Take(1).String()
-	working_tree := view.Take(1).String()
+	index, working_tree, ok := parseXY(view)
+	// Both sides of an unmerged change are always changed
+	if !ok || index == "." || working_tree == "." {
+		return
+	}
 
-	view.Seek(sv.Letter())
-	if view.Take(1).String() != "N" { // for now we don't worry about submodules
+	sub, ok := parseSubmoduleState(takeField(view).String())
+	if !ok {
 		return
 	}
 
-	view.SeekNext(sv.Whitespace()). // Skip <sub>
-					SeekNext(sv.Whitespace()). // Skip <m1>
-					SeekNext(sv.Whitespace()). // Skip <m2>
-					SeekNext(sv.Whitespace()). // Skip <m3>
-					SeekNext(sv.Whitespace()). // Skip <mW>
-					SeekNext(sv.Whitespace()). // Skip <h1>
-					SeekNext(sv.Whitespace()). // Skip <h2>
-					SeekNext(sv.Whitespace()). // Skip <h3>
-					SeekNext(sv.Letter())
+	takeField(view) // Skip <m1>
+	takeField(view) // Skip <m2>
+	takeField(view) // Skip <m3>
+	takeField(view) // Skip <mW>
+	takeField(view) // Skip <h1>
+	takeField(view) // Skip <h2>
+	takeField(view) // Skip <h3>
 
-	path := view.TakeLine().String()
+	path := view.String()
 
 	statuz.unmerged = append(
 		statuz.unmerged,
@@ -400,6 +655,7 @@ func parseUnmergedChange(statuz *status, view *sv.StringView) {
 				changeKindFromString(working_tree),
 			},
 			file: path,
+			sub:  sub,
 		},
 	)
 }
@@ -1,20 +1,221 @@
 package git
 
 import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
-var statusTextRaw = `
-# branch.oid 1476deeddba487aa5e58c9d696c8f3b49df6ca1e
-# branch.head feat/go-rewrite
-# branch.upstream origin/feat/go-rewrite
-# branch.ab +0 -0
-1 .M N... 100644 100644 100644 ede67606cd3cd505a02e33a7c681f792c950f14e ede67606cd3cd505a02e33a7c681f792c950f14e git/status.go
-? lib/slice/find.go
-? lib/string-view/
-`
+const sha = "ede67606cd3cd505a02e33a7c681f792c950f14e"
+
+// Joins the entries like `git status -z` does, ending each with a NUL.
+func statusEntries(entries ...string) string {
+	return strings.Join(entries, "\x00") + "\x00"
+}
+
+var statusTextRaw = statusEntries(
+	"# branch.oid 1476deeddba487aa5e58c9d696c8f3b49df6ca1e",
+	"# branch.head feat/go-rewrite",
+	"# branch.upstream origin/feat/go-rewrite",
+	"# branch.ab +0 -0",
+	"1 .M N... 100644 100644 100644 "+sha+" "+sha+" git/status.go",
+	"? lib/slice/find.go",
+	"? lib/string-view/",
+)
 
 func TestParsingStatus(t *testing.T) {
 	statuz := parseGitStatus(&statusTextRaw)
 	t.Logf("%v", *statuz)
 }
+
+func TestParsingStashCount(t *testing.T) {
+	raw := statusEntries("# branch.oid 1476deeddba487aa5e58c9d696c8f3b49df6ca1e", "# branch.head main", "# stash 3", "? notes.txt")
+	statuz := parseGitStatus(&raw)
+	assert.Equal(t, 3, statuz.stashCount)
+	assert.Equal(t, "main", statuz.branch.name)
+}
+
+func TestParsingIgnored(t *testing.T) {
+	raw := statusEntries("# branch.oid 1476deeddba487aa5e58c9d696c8f3b49df6ca1e", "# branch.head main", "? notes.txt", "! build/", "! .env")
+	statuz := parseGitStatus(&raw)
+	assert.Equal(t, []string{"notes.txt"}, statuz.untracked)
+	assert.Equal(t, []string{"build/", ".env"}, statuz.ignored)
+}
+
+func TestParsingStatusEntries(t *testing.T) {
+	orig := func(path string) *string { return &path }
+	tests := []struct {
+		name     string
+		entries  []string
+		expected status
+	}{
+		{
+			name:    "branch with upstream",
+			entries: []string{"# branch.oid " + sha, "# branch.head main", "# branch.upstream origin/main", "# branch.ab +2 -13"},
+			expected: status{branch: branch{
+				name:     "main",
+				commit:   sha,
+				upstream: &upstream{ahead: 2, behind: 13, ref: "origin/main"},
+			}},
+		},
+		{
+			name:    "path with spaces",
+			entries: []string{"1 M. N... 100644 100644 100644 " + sha + " " + sha + " dir/my file.txt"},
+			expected: status{
+				staged: []change{{kind: MODIFIED, file: "dir/my file.txt"}},
+			},
+		},
+		{
+			name:    "path starting with a dot or space",
+			entries: []string{"1 .D N... 100644 100644 000000 " + sha + " " + sha + " .env", "1 A. N... 000000 100644 100644 " + sha + " " + sha + "  lead"},
+			expected: status{
+				staged:   []change{{kind: ADDED, file: " lead"}},
+				unstaged: []change{{kind: DELETED, file: ".env"}},
+			},
+		},
+		{
+			name:    "path with a tab, newline and non-ASCII characters",
+			entries: []string{"1 .M N... 100644 100644 100644 " + sha + " " + sha + " tab\there\nthére"},
+			expected: status{
+				unstaged: []change{{kind: MODIFIED, file: "tab\there\nthére"}},
+			},
+		},
+		{
+			name:    "rename with spaces",
+			entries: []string{"2 R. N... 100644 100644 100644 " + sha + " " + sha + " R100 new name.txt", "old name.txt", "? after"},
+			expected: status{
+				staged:    []change{{kind: RENAMED, file: "new name.txt", orig_file: orig("old name.txt")}},
+				untracked: []string{"after"},
+			},
+		},
+		{
+			name:    "unmerged",
+			entries: []string{"u UU N... 100644 100644 100644 100644 " + sha + " " + sha + " " + sha + " both modified.txt"},
+			expected: status{
+				unmerged: []unmergedChange{{kind: [2]changeKind{UNMERGED, UNMERGED}, file: "both modified.txt"}},
+			},
+		},
+		{
+			name: "submodules",
+			entries: []string{
+				"1 .M SC.U 160000 160000 160000 " + sha + " " + sha + " sub",
+				"1 A. S... 000000 160000 160000 " + sha + " " + sha + " added",
+				"2 R. S.M. 160000 160000 160000 " + sha + " " + sha + " R100 moved",
+				"sub2",
+			},
+			expected: status{
+				staged: []change{
+					{kind: ADDED, file: "added", sub: &submoduleState{}},
+					{kind: RENAMED, file: "moved", orig_file: orig("sub2"), sub: &submoduleState{modified: true}},
+				},
+				unstaged: []change{{kind: MODIFIED, file: "sub", sub: &submoduleState{commitChanged: true, untracked: true}}},
+			},
+		},
+		{
+			name:    "unknown submodule states are skipped",
+			entries: []string{"1 .M SX.. 160000 160000 160000 " + sha + " " + sha + " sub", "? file"},
+			expected: status{
+				untracked: []string{"file"},
+			},
+		},
+		{
+			name:     "untracked and ignored",
+			entries:  []string{"? new file", "! build dir/"},
+			expected: status{untracked: []string{"new file"}, ignored: []string{"build dir/"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			raw := statusEntries(test.entries...)
+			statuz := parseGitStatus(&raw)
+			assert.Equal(t, test.expected, *statuz)
+		})
+	}
+}
+
+func FuzzParseGitStatus(f *testing.F) {
+	f.Add(statusTextRaw)
+	f.Add(statusEntries("2 RM N... 100644 100644 100644 "+sha+" "+sha+" R90 a b", "c d"))
+	f.Add(statusEntries("u AU N... 100644 100644 100644 100644 " + sha + " " + sha + " " + sha + " x"))
+	f.Add("1 .M\x00# branch.ab +\x00u\x00")
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		// Should never panic, whatever git writes
+		parseGitStatus(&raw)
+	})
+}
+
+func FuzzParseStatusPaths(f *testing.F) {
+	f.Add("file.txt", "orig.txt")
+	f.Add(" spaced name ", "tab\tname")
+	f.Add(".hidden", "\"quoted\"\n")
+	f.Add("ünïcödé/路径", "1 2 3")
+
+	f.Fuzz(func(t *testing.T, path string, orig_path string) {
+		// Paths can't be empty or contain NULs
+		if len(path) == 0 || len(orig_path) == 0 || strings.ContainsRune(path+orig_path, 0) {
+			t.Skip()
+		}
+		raw := statusEntries(
+			"1 .M N... 100644 100644 100644 "+sha+" "+sha+" "+path,
+			"2 R. N... 100644 100644 100644 "+sha+" "+sha+" R100 "+path, orig_path,
+			"? "+path,
+		)
+		statuz := parseGitStatus(&raw)
+		assert.Equal(t, []change{{kind: MODIFIED, file: path}}, statuz.unstaged)
+		assert.Equal(t, []change{{kind: RENAMED, file: path, orig_file: &orig_path}}, statuz.staged)
+		assert.Equal(t, []string{path}, statuz.untracked)
+	})
+}
+
+func TestFormatSize(t *testing.T) {
+	sizes := map[int64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1024:            "1.0 KiB",
+		1536:            "1.5 KiB",
+		5 * 1024 * 1024: "5.0 MiB",
+		3 << 30:         "3.0 GiB",
+		1<<40 + 512<<30: "1.5 TiB",
+	}
+	for bytes, expected := range sizes {
+		assert.Equal(t, expected, formatSize(bytes), "%d bytes", bytes)
+	}
+}
+
+func TestIgnoredUsageSkipsNestedRepositories(t *testing.T) {
+	root := t.TempDir()
+	write := func(path string, size int) {
+		path = filepath.Join(root, path)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, make([]byte, size), 0644))
+	}
+	write("build/out.bin", 3)
+	write("build/cache/.git/objects/pack", 100)
+	write("build/cache/main.go", 20)
+	write("build/worktree/.git", 30)
+	write("build/worktree/main.go", 40)
+	write("deps/other/main.go", 50)
+	write("deps/lib.a", 7)
+
+	usage := getIgnoredUsage(root, []string{"build/", "deps/"}, []string{root, filepath.Join(root, "deps", "other")})
+	assert.Equal(t, ignoredUsage{files: 2, size: 10}, usage)
+}
+
+func TestGetStatusReadsOnlyStdout(t *testing.T) {
+	dir := commitTestRepository(t)
+	// Makes git write its trace to stderr
+	t.Setenv("GIT_TRACE", "1")
+
+	statuz, err := getStatus(dir, StatusOptions{})
+	assert.NoError(t, err)
+	head, _ := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	assert.Equal(t, strings.TrimSpace(string(head)), statuz.branch.commit)
+	assert.Equal(t, "main", statuz.branch.name)
+	assert.Equal(t, []change{{kind: MODIFIED, file: "file.txt"}}, statuz.staged)
+}
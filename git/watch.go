@@ -0,0 +1,176 @@
+package git
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Otard95/ngm/lib/slice"
+	"github.com/Otard95/ngm/log"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/fsnotify/fsnotify"
+)
+
+// How long to wait for a burst of file system events to settle before
+// refreshing a repository.
+const watchDebounce = 200 * time.Millisecond
+
+// The files in the git directory that affect the status. Anything else in
+// there, like lock files and objects, is ignored to not refresh on every
+// internal write.
+var watchedGitFiles = []string{"index", "HEAD", "ORIG_HEAD", "MERGE_HEAD"}
+
+type directoryChangedMsg struct {
+	path string
+}
+
+// Watches the working tree and index of each repository, reporting which
+// repository changed.
+type watcher struct {
+	fs *fsnotify.Watcher
+	// The repository each watched directory is in
+	repos map[string]string
+	// The watched git directories, where only some files matter
+	gitDirs map[string]bool
+	changes chan string
+	// Closed when the watcher is closed, to stop anything still waiting to send
+	done chan struct{}
+}
+
+func newWatcher(paths []string) (*watcher, error) {
+	fs, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &watcher{
+		fs:      fs,
+		repos:   map[string]string{},
+		gitDirs: map[string]bool{},
+		changes: make(chan string),
+		done:    make(chan struct{}),
+	}
+	for _, repo := range paths {
+		gitDir, dirs := watchedDirectories(repo)
+		for _, dir := range dirs {
+			if err := fs.Add(dir); err != nil {
+				log.Debugf("Failed to watch %s: %v\n", dir, err)
+				continue
+			}
+			w.repos[dir] = repo
+		}
+		if len(gitDir) > 0 {
+			w.gitDirs[gitDir] = true
+		}
+	}
+
+	go w.run()
+	return w, nil
+}
+
+// The git directory of the repository, and the directories to watch: the
+// repository root, its git directory and every directory containing a tracked
+// file. Watching isn't recursive so untracked directories are only picked up
+// when they're created or removed. The git directory is asked for since it's
+// elsewhere for worktrees and submodules.
+func watchedDirectories(repo string) (string, []string) {
+	dirs := []string{path.Clean(repo)}
+	seen := map[string]bool{dirs[0]: true}
+
+	gitDir, err := gitOutput(repo, "", nil, "rev-parse", "--git-dir")
+	gitDir = strings.TrimSpace(gitDir)
+	if err != nil {
+		gitDir = ""
+	} else if len(gitDir) > 0 {
+		if !path.IsAbs(gitDir) {
+			gitDir = path.Join(repo, gitDir)
+		}
+		dirs = append(dirs, gitDir)
+		seen[gitDir] = true
+	}
+
+	out, err := gitOutput(repo, "", nil, "ls-files", "-z")
+	if err != nil {
+		return gitDir, dirs
+	}
+	for _, file := range strings.Split(out, "\x00") {
+		if len(file) == 0 {
+			continue
+		}
+		dir := path.Join(repo, path.Dir(file))
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return gitDir, dirs
+}
+
+func (w *watcher) run() {
+	pending := map[string]bool{}
+	settled := make(chan string)
+
+	for {
+		select {
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return
+			}
+			repo, ok := w.repos[path.Dir(event.Name)]
+			if !ok || !w.relevant(event.Name) || pending[repo] {
+				continue
+			}
+			pending[repo] = true
+			time.AfterFunc(watchDebounce, func() {
+				select {
+				case settled <- repo:
+				case <-w.done:
+				}
+			})
+
+		case repo := <-settled:
+			delete(pending, repo)
+			select {
+			case w.changes <- repo:
+			case <-w.done:
+				return
+			}
+
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return
+			}
+			log.Debugf("Watcher error: %v\n", err)
+		}
+	}
+}
+
+func (w *watcher) relevant(file string) bool {
+	if !w.gitDirs[path.Dir(file)] {
+		return true
+	}
+	return slice.Some(watchedGitFiles, func(f string) bool { return f == path.Base(file) })
+}
+
+// Waits for the next changed repository. Must be re-issued after each message
+// to keep listening.
+func (w *watcher) Wait() tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case <-w.done:
+			return nil
+		default:
+		}
+		select {
+		case repo := <-w.changes:
+			return directoryChangedMsg{path: repo}
+		case <-w.done:
+			return nil
+		}
+	}
+}
+
+func (w *watcher) Close() error {
+	close(w.done)
+	return w.fs.Close()
+}
@@ -0,0 +1,55 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcherStopsWhenClosed(t *testing.T) {
+	dir := commitTestRepository(t)
+	w, err := newWatcher([]string{dir})
+	assert.NoError(t, err)
+
+	os.WriteFile(filepath.Join(dir, "file.txt"), []byte("c\n"), 0644)
+	assert.Equal(t, directoryChangedMsg{path: dir}, w.Wait()())
+
+	// Nothing waits for this change, which mustn't keep the watcher running
+	os.WriteFile(filepath.Join(dir, "file.txt"), []byte("d\n"), 0644)
+	time.Sleep(2 * watchDebounce)
+	assert.NoError(t, w.Close())
+	assert.Nil(t, w.Wait()())
+}
+
+func TestWatchedDirectoriesOfWorktree(t *testing.T) {
+	dir := commitTestRepository(t)
+	worktree := filepath.Join(t.TempDir(), "worktree")
+	assert.NoError(t, exec.Command("git", "-C", dir, "worktree", "add", "-q", "-b", "other", worktree).Run())
+
+	gitDir, dirs := watchedDirectories(worktree)
+	assert.Equal(t, filepath.Join(dir, ".git", "worktrees", "worktree"), gitDir)
+	assert.Equal(t, []string{worktree, gitDir}, dirs)
+
+	w := &watcher{gitDirs: map[string]bool{gitDir: true}}
+	assert.True(t, w.relevant(filepath.Join(gitDir, "index")))
+	assert.False(t, w.relevant(filepath.Join(gitDir, "index.lock")))
+	assert.True(t, w.relevant(filepath.Join(worktree, "file.txt")))
+}
+
+func TestReadingStatusDoesNotWriteIndex(t *testing.T) {
+	dir := commitTestRepository(t)
+	index := filepath.Join(dir, ".git", "index")
+	// Makes the index outdated, which git status would otherwise refresh
+	future := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "file.txt"), future, future))
+	before, _ := os.Stat(index)
+
+	_, _, err := readDirectory(dir)
+	assert.NoError(t, err)
+	after, _ := os.Stat(index)
+	assert.Equal(t, before.ModTime(), after.ModTime())
+}
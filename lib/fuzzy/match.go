@@ -0,0 +1,55 @@
+package fuzzy
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Matches the pattern as a case insensitive subsequence of the string.
+//
+// The score favours consecutive characters and characters at the start of a
+// word or path segment, so `ngm` scores higher for `ngm/git` than for
+// `nothing/magic`.
+func Match(pattern, s string) (int, bool) {
+	if len(pattern) == 0 {
+		return 0, true
+	}
+
+	score := 0
+	consecutive := 0
+	prev := '/'
+	p, size := utf8.DecodeRuneInString(pattern)
+	pattern = pattern[size:]
+
+	for _, r := range s {
+		if unicode.ToLower(r) == unicode.ToLower(p) {
+			score++
+			if consecutive > 0 {
+				score += consecutive * 2
+			}
+			if isBoundary(prev) {
+				score += 3
+			}
+			consecutive++
+
+			if len(pattern) == 0 {
+				return score, true
+			}
+			p, size = utf8.DecodeRuneInString(pattern)
+			pattern = pattern[size:]
+		} else {
+			consecutive = 0
+		}
+		prev = r
+	}
+
+	return 0, false
+}
+
+func isBoundary(r rune) bool {
+	switch r {
+	case '/', '.', '-', '_', ' ':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,25 @@
+package fuzzy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	_, ok := Match("stgo", "git/status.go")
+	assert.True(t, ok, "should match a subsequence")
+
+	_, ok = Match("STATUS", "git/status.go")
+	assert.True(t, ok, "should ignore case")
+
+	_, ok = Match("gits", "git/diff.go")
+	assert.False(t, ok, "should not match when characters are missing")
+
+	_, ok = Match("", "anything")
+	assert.True(t, ok, "an empty pattern should match everything")
+
+	boundary, _ := Match("ngm", "ngm/git")
+	scattered, _ := Match("ngm", "nothing/magic")
+	assert.Greater(t, boundary, scattered, "consecutive matches should score higher")
+}